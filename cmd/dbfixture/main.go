@@ -0,0 +1,43 @@
+// Command dbfixture loads YAML/JSON fixture files into database opened by libdb.Open
+//
+//	dbfixture -env db -truncate=true fixtures/users.yml fixtures/posts.yml
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/helloferdie/golib/libdb"
+)
+
+func main() {
+	env := flag.String("env", "db", "Database environment prefix, e.g. db reads db_driver, db_host")
+	truncate := flag.Bool("truncate", true, "Delete existing rows of fixture tables before loading")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: dbfixture [-env db] [-truncate=true] file...")
+		os.Exit(2)
+	}
+
+	fx, err := libdb.ReadFixture(flag.Args()...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	d, err := libdb.Open(*env)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer libdb.CloseAll()
+
+	l := libdb.FixtureLoader{Mode: libdb.DefaultMode, Truncate: *truncate}
+	if err := l.Load(d, fx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println("Fixture loaded")
+}
@@ -16,6 +16,7 @@ require (
 	go.uber.org/zap v1.26.0
 	golang.org/x/text v0.14.0
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
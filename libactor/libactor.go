@@ -0,0 +1,31 @@
+package libactor
+
+import "context"
+
+// Actor - Identity and origin of request, populated once per request by libmiddleware.Actor
+type Actor struct {
+	UserID    int64  `json:"user_id"`
+	TokenID   string `json:"token_id"`
+	Access    string `json:"access"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	RequestID string `json:"request_id"`
+}
+
+// contextKey - Unexported key type to avoid collision with other package
+type contextKey struct{}
+
+// WithActor - Return copy of context carrying actor
+func WithActor(ctx context.Context, a *Actor) context.Context {
+	return context.WithValue(ctx, contextKey{}, a)
+}
+
+// FromContext - Get actor carried by context, empty actor when not set
+func FromContext(ctx context.Context) *Actor {
+	if ctx != nil {
+		if a, ok := ctx.Value(contextKey{}).(*Actor); ok && a != nil {
+			return a
+		}
+	}
+	return new(Actor)
+}
@@ -0,0 +1,479 @@
+package libaudittrail
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/helloferdie/golib/libdb"
+	"github.com/helloferdie/golib/liblogger"
+	"github.com/helloferdie/golib/libsecret"
+	"github.com/jmoiron/sqlx"
+)
+
+// Chain scope, chain is always per service instance (service_ip, hostname:port) so concurrent instances never fork
+// a chain. Restart with new hostname starts new chain, removal of whole chain of retired instance breaks no link
+// and is only detected by VerifyCheckpoint
+//   - ChainInstance: One chain per instance
+//   - ChainInstanceTable: One chain per instance and table
+const (
+	ChainInstance      = "instance"
+	ChainInstanceTable = "instance_table"
+)
+
+// ErrChainKey - Checkpoint signing key `audit_chain_key` not configured
+var ErrChainKey = errors.New("Error audit chain: signing key not configured")
+
+var chainMu sync.RWMutex
+var defaultChain *Chain
+
+// UseChain - Register hash chain used by Log, set nil to disable
+func UseChain(c *Chain) {
+	chainMu.Lock()
+	defer chainMu.Unlock()
+	defaultChain = c
+}
+
+// getChain -
+func getChain() *Chain {
+	chainMu.RLock()
+	defer chainMu.RUnlock()
+	return defaultChain
+}
+
+// chainHead - Last sealed record of chain
+type chainHead struct {
+	ID   string
+	Hash string
+}
+
+// Chain - Link every record to previous record of same chain by hash
+type Chain struct {
+	DB    *sqlx.DB
+	Scope string
+
+	mu           sync.Mutex
+	head         map[string]*chainHead
+	checkpointed map[string]string
+	sealedTx     bool
+}
+
+// NewChain - Create chain, head of each chain is resumed from audit_trail table on given connection (nil to start fresh)
+func NewChain(d *sqlx.DB, scope string) *Chain {
+	if scope == "" {
+		scope = ChainInstance
+	}
+	return &Chain{DB: d, Scope: scope, head: map[string]*chainHead{}, checkpointed: map[string]string{}}
+}
+
+// LoadChain - Build chain from `audit_chain` environment, `instance` or `instance_table`, nil when empty
+func LoadChain(d *sqlx.DB) (*Chain, error) {
+	scope := os.Getenv("audit_chain")
+	switch scope {
+	case "":
+		return nil, nil
+	case ChainInstance, ChainInstanceTable:
+		return NewChain(d, scope), nil
+	}
+	return nil, errors.New("Error audit chain: unsupported scope " + scope)
+}
+
+// chainKey - Key of chain the record belongs to
+func chainKey(scope string, m *Model) string {
+	if scope == ChainInstanceTable {
+		return m.ServiceIP + "/" + m.TableName
+	}
+	return m.ServiceIP
+}
+
+// ComputeHash - SHA-256 of record content and previous hash, created_at is hashed with second precision as stamped
+func (m *Model) ComputeHash() string {
+	createdAt := ""
+	if m.CreatedAt.Valid {
+		createdAt = m.CreatedAt.Time.UTC().Format(time.RFC3339)
+	}
+	bt, _ := json.Marshal([]interface{}{
+		m.ID, m.Operation, m.ModuleName, m.TableName, m.TableKey, m.Change, m.Remark,
+		m.ServiceIP, m.TokenID, m.CreatedBy, m.IP, m.UserAgent, m.RequestID, createdAt, m.PrevHash,
+	})
+	sum := sha256.Sum256(bt)
+	return hex.EncodeToString(sum[:])
+}
+
+// WriteSealed - Assign timestamp and ID, seal records in order and write them while holding chain lock,
+// so sealing order equals `created_at, id` order walked by Verify. Head only advances when write succeeds,
+// on failure hash of every record is cleared so record is sealed again when written later
+func (c *Chain) WriteSealed(list []*Model, write func(list []*Model) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tentative := map[string]chainHead{}
+	for _, m := range list {
+		if err := m.stamp(); err != nil {
+			unseal(list)
+			return err
+		}
+
+		key := chainKey(c.Scope, m)
+		h, ok := tentative[key]
+		if !ok {
+			current, err := c.current(m, key)
+			if err != nil {
+				unseal(list)
+				return err
+			}
+			h = *current
+		}
+
+		m.PrevHash = h.Hash
+		m.Hash = m.ComputeHash()
+		h.ID = m.ID
+		h.Hash = m.Hash
+		tentative[key] = h
+	}
+
+	if err := write(list); err != nil {
+		unseal(list)
+		return err
+	}
+	for key, h := range tentative {
+		c.head[key].ID = h.ID
+		c.head[key].Hash = h.Hash
+	}
+	return nil
+}
+
+// current - Get head of chain, resumed from database when not cached, caller must hold lock
+func (c *Chain) current(m *Model, key string) (*chainHead, error) {
+	if h, ok := c.head[key]; ok {
+		return h, nil
+	}
+	h, err := c.resume(m)
+	if err != nil {
+		return nil, err
+	}
+	c.head[key] = h
+	if _, ok := c.checkpointed[key]; !ok {
+		c.checkpointed[key] = h.ID
+	}
+	return h, nil
+}
+
+// unseal - Clear hash of records not written
+func unseal(list []*Model) {
+	for _, m := range list {
+		m.PrevHash = ""
+		m.Hash = ""
+	}
+}
+
+// ChainHeadTable - Table with columns chain_key (primary key), last_id and last_hash, its row locked to serialize transactional sealing
+var ChainHeadTable = "audit_chain_head"
+
+// SealTx - Assign timestamp and ID then seal record written in transaction. Head row of chain is locked with
+// SELECT ... FOR UPDATE until transaction ends, so concurrent transactions of same chain are sealed one after another.
+// Head of transactional chain is kept in head row only, read by Checkpoint once committed. Cached head dropped so next
+// WriteSealed resumes from database; pending record of asynchronous writer is not visible, do not mix transactional
+// and non transactional logging for the same chain
+func (c *Chain) SealTx(tx *sqlx.Tx, m *Model) error {
+	key := chainKey(c.Scope, m)
+	values := map[string]interface{}{"chain_key": key}
+
+	insert := "INSERT IGNORE INTO " + ChainHeadTable + " (chain_key, last_id, last_hash) VALUES (:chain_key, '', '')"
+	if tx.DriverName() == "postgres" {
+		insert = "INSERT INTO " + ChainHeadTable + " (chain_key, last_id, last_hash) VALUES (:chain_key, '', '') ON CONFLICT (chain_key) DO NOTHING"
+	}
+	if _, err := tx.NamedExec(insert, values); err != nil {
+		return err
+	}
+
+	head := struct {
+		LastID   string `db:"last_id"`
+		LastHash string `db:"last_hash"`
+	}{}
+	_, err := libdb.TxGet(tx, &head, "SELECT last_id, last_hash FROM "+ChainHeadTable+" WHERE chain_key = :chain_key FOR UPDATE", values)
+	if err != nil {
+		return err
+	}
+
+	// First transactional record of chain continues from record written before head table existed
+	if head.LastHash == "" {
+		query, qv := c.headQuery(m)
+		last := new(Model)
+		if _, err := libdb.TxGet(tx, last, query, qv); err != nil {
+			return err
+		}
+		head.LastHash = last.Hash
+	}
+
+	// Stamp after lock so ID and timestamp follow sealing order
+	if err := m.stamp(); err != nil {
+		return err
+	}
+	m.PrevHash = head.LastHash
+	m.Hash = m.ComputeHash()
+
+	values["last_id"] = m.ID
+	values["last_hash"] = m.Hash
+	_, err = tx.NamedExec("UPDATE "+ChainHeadTable+" SET last_id = :last_id, last_hash = :last_hash WHERE chain_key = :chain_key", values)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	delete(c.head, key)
+	c.sealedTx = true
+	c.mu.Unlock()
+	return nil
+}
+
+// headQuery - Query latest sealed record of chain
+func (c *Chain) headQuery(m *Model) (string, map[string]interface{}) {
+	query := "SELECT id, hash FROM " + TConfig.Table + " WHERE service_ip = :service_ip AND hash <> '' "
+	values := map[string]interface{}{"service_ip": m.ServiceIP}
+	if c.Scope == ChainInstanceTable {
+		query += "AND table_name = :table_name "
+		values["table_name"] = m.TableName
+	}
+	query += "ORDER BY created_at DESC, id DESC LIMIT 1"
+	return query, values
+}
+
+// resume - Load latest sealed record of chain from database
+func (c *Chain) resume(m *Model) (*chainHead, error) {
+	h := new(chainHead)
+	if c.DB == nil {
+		return h, nil
+	}
+
+	query, values := c.headQuery(m)
+	last := new(Model)
+	exist, err := libdb.Get(c.DB, last, query, values)
+	if err != nil {
+		return nil, err
+	}
+	if exist {
+		h.ID = last.ID
+		h.Hash = last.Hash
+	}
+	return h, nil
+}
+
+// signCheckpoint - HMAC-SHA256 of checkpoint content keyed by secret `audit_chain_key`
+func signCheckpoint(cp *Checkpoint) (string, error) {
+	key := libsecret.Get("audit_chain_key")
+	if key == "" {
+		return "", ErrChainKey
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(cp.ChainKey + "\n" + cp.LastID + "\n" + cp.LastHash + "\n" + cp.CreatedAt.Time.UTC().Format(time.RFC3339)))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Checkpoint - Write signed checkpoint of every chain advanced since previous checkpoint, including committed head
+// rows of chains sealed by SealTx
+func (c *Chain) Checkpoint(d *sqlx.DB) error {
+	c.mu.Lock()
+	head := map[string]chainHead{}
+	for key, h := range c.head {
+		head[key] = *h
+	}
+	sealedTx := c.sealedTx
+	c.mu.Unlock()
+
+	if sealedTx {
+		rows := []struct {
+			ChainKey string `db:"chain_key"`
+			LastID   string `db:"last_id"`
+			LastHash string `db:"last_hash"`
+		}{}
+		err := libdb.Select(d, &rows, "SELECT chain_key, last_id, last_hash FROM "+ChainHeadTable+" WHERE last_id <> ''", map[string]interface{}{})
+		if err != nil {
+			return err
+		}
+		for _, r := range rows {
+			// Cached head is newer, head row is only resumed into cache by WriteSealed
+			if _, ok := head[r.ChainKey]; !ok {
+				head[r.ChainKey] = chainHead{ID: r.LastID, Hash: r.LastHash}
+			}
+		}
+	}
+
+	for key, h := range head {
+		c.mu.Lock()
+		checkpointed := c.checkpointed[key]
+		c.mu.Unlock()
+		if h.ID == "" || h.ID == checkpointed {
+			continue
+		}
+
+		cp := &Checkpoint{ChainKey: key, LastID: h.ID, LastHash: h.Hash}
+		cp.CreatedAt.Valid = true
+		cp.CreatedAt.Time = time.Now().UTC()
+		sig, err := signCheckpoint(cp)
+		if err != nil {
+			return err
+		}
+		cp.Signature = sig
+		err = libdb.Create(d, CPConfig, cp, dbMode, false)
+		if err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		c.checkpointed[key] = cp.LastID
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// RunCheckpoint - Write checkpoint every interval until context cancelled
+func (c *Chain) RunCheckpoint(ctx context.Context, d *sqlx.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Checkpoint(d); err != nil {
+				liblogger.Log(nil, true).Errorf("Error audit chain checkpoint %v", err)
+			}
+		}
+	}
+}
+
+// ChainBreak - First broken link found by verification
+type ChainBreak struct {
+	ID       string `json:"id"`
+	ChainKey string `json:"chain_key"`
+	Reason   string `json:"reason"`
+}
+
+// VerifyResult - Chain verification report, Break is nil when every record is intact
+type VerifyResult struct {
+	Checked int64       `json:"checked"`
+	Chains  int         `json:"chains"`
+	Break   *ChainBreak `json:"break,omitempty"`
+}
+
+// VerifyBatchSize - Records read per query during verification
+var VerifyBatchSize = 1000
+
+// Verify - Walk records matching filter in sealing order and report first broken link.
+// Filter should select whole chains (table, time range), record sealed before chaining enabled is skipped
+func Verify(ctx context.Context, d *sqlx.DB, scope string, f Filter) (*VerifyResult, error) {
+	result := new(VerifyResult)
+	head := map[string]string{}
+	mc := f.condition()
+
+	var afterAt time.Time
+	afterID := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		query := "SELECT " + TConfig.Fields + " FROM " + TConfig.Table + " WHERE 1=1 " + mc.Query
+		values := mc.GetValue()
+		if afterID != "" {
+			query += "AND (created_at > :after_at OR (created_at = :after_at AND id > :after_id)) "
+			values["after_at"] = afterAt
+			values["after_id"] = afterID
+		}
+		query += "ORDER BY created_at ASC, id ASC LIMIT " + strconv.Itoa(VerifyBatchSize)
+
+		list := []Model{}
+		err := libdb.Select(d, &list, query, values)
+		if err != nil {
+			return result, err
+		}
+
+		for k := range list {
+			m := &list[k]
+			key := chainKey(scope, m)
+			prev, started := head[key]
+			result.Checked++
+
+			if m.Hash == "" {
+				if started {
+					result.Break = &ChainBreak{ID: m.ID, ChainKey: key, Reason: "missing hash"}
+					return result, nil
+				}
+				continue
+			}
+			if m.ComputeHash() != m.Hash {
+				result.Break = &ChainBreak{ID: m.ID, ChainKey: key, Reason: "hash mismatch"}
+				return result, nil
+			}
+			// First record of chain within filter may link to record outside filter
+			if started && m.PrevHash != prev {
+				result.Break = &ChainBreak{ID: m.ID, ChainKey: key, Reason: "previous hash mismatch"}
+				return result, nil
+			}
+			head[key] = m.Hash
+		}
+
+		if len(list) < VerifyBatchSize {
+			break
+		}
+		afterAt = list[len(list)-1].CreatedAt.Time
+		afterID = list[len(list)-1].ID
+	}
+
+	result.Chains = len(head)
+	return result, nil
+}
+
+// VerifyCheckpoint - Verify checkpoints created since given time are authentic and their head record is unchanged,
+// detect removal of records at the end of chain
+func VerifyCheckpoint(d *sqlx.DB, from time.Time) (*VerifyResult, error) {
+	result := new(VerifyResult)
+	list := []Checkpoint{}
+	err := libdb.Select(d, &list, "SELECT "+CPConfig.Fields+" FROM "+CPConfig.Table+" WHERE created_at >= :from ORDER BY created_at ASC, id ASC", map[string]interface{}{
+		"from": from.UTC(),
+	})
+	if err != nil {
+		return result, err
+	}
+
+	chains := map[string]bool{}
+	for _, cp := range list {
+		result.Checked++
+		chains[cp.ChainKey] = true
+
+		sig, err := signCheckpoint(&cp)
+		if err != nil {
+			return result, err
+		}
+		if !hmac.Equal([]byte(sig), []byte(cp.Signature)) {
+			result.Break = &ChainBreak{ID: cp.LastID, ChainKey: cp.ChainKey, Reason: "invalid checkpoint signature " + cp.ID}
+			return result, nil
+		}
+
+		m := new(Model)
+		exist, err := libdb.Get(d, m, "SELECT "+TConfig.Fields+" FROM "+TConfig.Table+" WHERE id = :id", map[string]interface{}{
+			"id": cp.LastID,
+		})
+		if err != nil {
+			return result, err
+		}
+		if !exist {
+			result.Break = &ChainBreak{ID: cp.LastID, ChainKey: cp.ChainKey, Reason: "checkpoint record missing"}
+			return result, nil
+		}
+		if m.Hash != cp.LastHash || m.ComputeHash() != m.Hash {
+			result.Break = &ChainBreak{ID: cp.LastID, ChainKey: cp.ChainKey, Reason: "checkpoint hash mismatch"}
+			return result, nil
+		}
+	}
+	result.Chains = len(chains)
+	return result, nil
+}
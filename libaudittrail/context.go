@@ -0,0 +1,68 @@
+package libaudittrail
+
+import (
+	"context"
+
+	"github.com/helloferdie/golib/libactor"
+	"github.com/helloferdie/golib/libdb"
+	"github.com/jmoiron/sqlx"
+)
+
+// userAgentLength - Maximum stored user agent length
+const userAgentLength = 255
+
+// SetActor - Fill creator, token, IP, user agent and request ID from actor, non empty creator and token kept
+func (m *Model) SetActor(a *libactor.Actor) *Model {
+	if a == nil {
+		return m
+	}
+	if m.CreatedBy == 0 {
+		m.CreatedBy = a.UserID
+	}
+	if m.TokenID == "" {
+		m.TokenID = a.TokenID
+	}
+	m.IP = a.IP
+	m.UserAgent = a.UserAgent
+	if len(m.UserAgent) > userAgentLength {
+		m.UserAgent = m.UserAgent[:userAgentLength]
+	}
+	m.RequestID = a.RequestID
+	return m
+}
+
+// logContext - Fill actor of context and write record
+func logContext(ctx context.Context, d *sqlx.DB, m *Model) error {
+	m.SetActor(libactor.FromContext(ctx))
+	return m.LogContext(ctx, d)
+}
+
+// LogCreateContext - Create record to database, actor read from context
+func LogCreateContext(ctx context.Context, d *sqlx.DB, cfg libdb.Config, dt interface{}, key interface{}, remark string) error {
+	return logContext(ctx, d, PrepareLogCreate(cfg, dt, key, 0, "", remark))
+}
+
+// LogUpdateContext - Update record from database, actor read from context
+func LogUpdateContext(ctx context.Context, d *sqlx.DB, cfg libdb.Config, dt interface{}, key interface{}, remark string) error {
+	return logContext(ctx, d, PrepareLogUpdate(cfg, dt, key, 0, "", remark))
+}
+
+// LogDeleteContext - Permanently delete record from database, actor read from context
+func LogDeleteContext(ctx context.Context, d *sqlx.DB, cfg libdb.Config, dt interface{}, key interface{}, remark string) error {
+	return logContext(ctx, d, PrepareLogDelete(cfg, dt, key, 0, "", remark))
+}
+
+// LogSoftDeleteContext - Soft delete record from database, actor read from context
+func LogSoftDeleteContext(ctx context.Context, d *sqlx.DB, cfg libdb.Config, key interface{}, remark string) error {
+	return logContext(ctx, d, PrepareLogSoftDelete(cfg, key, 0, "", remark))
+}
+
+// LogUnsoftDeleteContext - Revert soft delete record from database, actor read from context
+func LogUnsoftDeleteContext(ctx context.Context, d *sqlx.DB, cfg libdb.Config, key interface{}, remark string) error {
+	return logContext(ctx, d, PrepareLogUnsoftDelete(cfg, key, 0, "", remark))
+}
+
+// LogViewContext - View record from database, actor read from context
+func LogViewContext(ctx context.Context, d *sqlx.DB, cfg libdb.Config, key interface{}, remark string) error {
+	return logContext(ctx, d, PrepareLogView(cfg, key, 0, "", remark))
+}
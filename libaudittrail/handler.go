@@ -0,0 +1,61 @@
+package libaudittrail
+
+import (
+	"strconv"
+
+	"github.com/helloferdie/golib/libdb"
+	"github.com/helloferdie/golib/libecho"
+	"github.com/helloferdie/golib/liblogger"
+	"github.com/helloferdie/golib/libresponse"
+	"github.com/helloferdie/golib/libtime"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+// HistoryHandler - Handler returning history of record, key read from route param and pagination from `page` and `items_per_page` query
+func HistoryHandler(d *sqlx.DB, cfg libdb.Config, param string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		response := libresponse.GetDefault()
+		key := c.Param(param)
+		if key == "" {
+			response.ErrorDataNotFound()
+			return libecho.ParseResponse(c, response)
+		}
+
+		pagination := &libdb.ModelPaginationRequest{Page: 1, ItemsPerPage: 20}
+		if v, err := strconv.ParseInt(c.QueryParam("page"), 10, 64); err == nil && v > 0 {
+			pagination.Page = v
+		}
+		if v, err := strconv.ParseInt(c.QueryParam("items_per_page"), 10, 64); err == nil && v > 0 && v <= 500 {
+			pagination.ItemsPerPage = v
+		}
+
+		list, total, err := ListByRecord(d, cfg, key, pagination)
+		if err != nil {
+			liblogger.Log(nil, true).Errorf("Error list audit history %v", err)
+			response.ErrorList()
+			return libecho.ParseResponse(c, response)
+		}
+
+		format := libresponse.GetFormatOutput()
+		tz, _ := format["timezone"].(string)
+		items := make([]interface{}, 0, len(list))
+		for k := range list {
+			m := libresponse.MapOutput(list[k], false, format)
+			m["created_at"] = libtime.NullFormat(m["created_at"], tz)
+			change, err := list[k].DecodeChange()
+			if err == nil {
+				m["change"] = change
+			}
+			items = append(items, m)
+		}
+
+		response.SuccessList()
+		response.Data = libresponse.Pagination{
+			Items:      items,
+			TotalItems: total,
+			TotalPages: int64(libresponse.TotalPages(pagination.ItemsPerPage, total)),
+		}
+		return libecho.ParseResponse(c, response)
+	}
+}
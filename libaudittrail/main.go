@@ -1,62 +1,95 @@
 package libaudittrail
 
 import (
+	"context"
 	"encoding/json"
-
-	"strconv"
+	"fmt"
 	"time"
 
 	"github.com/helloferdie/golib/libdb"
+	"github.com/helloferdie/golib/libid"
+	"github.com/helloferdie/golib/liblogger"
 	"github.com/jmoiron/sqlx"
 )
 
-// generate - Generate default struct
-func generate(cfg libdb.Config, dt interface{}, key interface{}, creatorID int64, tokenID string, remark string) *Model {
-	v, ok := key.(string)
-	if !ok {
-		i, ok := key.(int64)
-		if ok {
-			v = strconv.FormatInt(i, 10)
-		} else {
-			v = ""
-		}
+// formatKey - Format table key into string, string and every integer kind are supported, other type is empty
+func formatKey(key interface{}) string {
+	switch v := key.(type) {
+	case string:
+		return v
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v)
 	}
+	return ""
+}
 
+// generate - Generate default struct
+func generate(cfg libdb.Config, dt interface{}, key interface{}, creatorID int64, tokenID string, remark string) *Model {
 	m := new(Model)
 	m.TableName = cfg.Table
-	m.TableKey = v
+	m.TableKey = formatKey(key)
 	m.ModuleName = cfg.Module
 	m.Remark = remark
 	m.TokenID = tokenID
 	m.CreatedBy = creatorID
 
 	if dt != nil {
-		bt, _ := json.Marshal(dt)
+		bt, _ := json.Marshal(cfg.RedactPayload(dt))
 		m.Change = string(bt)
 	}
 	return m
 }
 
-// GenerateID -
-func (m *Model) GenerateID() {
-	id, err := sf.NextID()
-	for err != nil {
-		id, err = sf.NextID()
+// GenerateID - Generate ID with shared sonyflake generator, machine ID configured by libid.LoadMachineConfig or libid.SetDefaultSonyflake
+func (m *Model) GenerateID() error {
+	id, err := libid.SonyflakeID.Generate()
+	if err != nil {
+		liblogger.Log(nil, true).Errorf("Error generate audit trail ID %v", err)
+		return err
 	}
-	m.ID = strconv.FormatUint(id, 10)
+	m.ID = id
+	return nil
 }
 
-// Log -
-func (m *Model) Log(d *sqlx.DB) error {
+// prepare - Fill service IP, timestamp and ID before writing
+func (m *Model) prepare() error {
 	loadConfig()
 
 	m.ServiceIP = serviceIP
+	return m.stamp()
+}
+
+// stamp - Fill timestamp and ID, assigned again under chain lock when sealed. Timestamp truncated to second,
+// column without fractional second rounds instead, so stored value always equals hashed value
+func (m *Model) stamp() error {
 	m.CreatedAt.Valid = true
-	m.CreatedAt.Time = time.Now().UTC()
-	m.GenerateID()
+	m.CreatedAt.Time = time.Now().UTC().Truncate(time.Second)
+	return m.GenerateID()
+}
 
-	err := libdb.Create(d, TConfig, m, dbMode, false)
-	return err
+// Log - Write record with background context, see LogContext
+func (m *Model) Log(d *sqlx.DB) error {
+	return m.LogContext(context.Background(), d)
+}
+
+// LogContext - Write record into registered sink (default audit_trail table), queued to asynchronous writer when registered with UseWriter.
+// Record is sealed into hash chain when chain registered with UseChain, by writer goroutine when asynchronous
+func (m *Model) LogContext(ctx context.Context, d *sqlx.DB) error {
+	if err := m.prepare(); err != nil {
+		return err
+	}
+	if w := getWriter(); w != nil {
+		return w.Write(m)
+	}
+
+	sink := getSink(d)
+	write := func(list []*Model) error {
+		return sink.Write(ctx, list)
+	}
+	if c := getChain(); c != nil {
+		return c.WriteSealed([]*Model{m}, write)
+	}
+	return write([]*Model{m})
 }
 
 // PrepareLogCreate - Prepare create log
@@ -0,0 +1,116 @@
+package libaudittrail
+
+import (
+	"net/http"
+
+	"github.com/helloferdie/golib/libactor"
+	"github.com/helloferdie/golib/libdb"
+	"github.com/helloferdie/golib/libecho"
+	"github.com/helloferdie/golib/libjwt"
+	"github.com/helloferdie/golib/liblogger"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// Echo context key read by Middleware, set by handler to refine recorded event
+//   - ContextKey: Record key, e.g. ID of created record
+//   - ContextChange: Change payload, e.g. created data or libdb.Diff of update
+//   - ContextSkip: Set true when handler already logged the event
+const (
+	ContextKey    = "audit_key"
+	ContextChange = "audit_change"
+	ContextSkip   = "audit_skip"
+)
+
+// DefaultOperations - Operation recorded by HTTP method
+var DefaultOperations = map[string]string{
+	http.MethodGet:    "view",
+	http.MethodPost:   "create",
+	http.MethodPut:    "update",
+	http.MethodPatch:  "update",
+	http.MethodDelete: "delete",
+}
+
+// MiddlewareConfig - Audit middleware configuration of route group
+//   - Config: Table and module of route group
+//   - Routes: Table and module per route path (e.g. `/user/:id/address`), take precedence over Config
+//   - Param: Route param holding record key, default to `id`
+//   - Operations: Operation by HTTP method, default to DefaultOperations, method not listed is skipped.
+//     `delete` is recorded as `softdelete` when table config has SoftDelete
+type MiddlewareConfig struct {
+	Skipper    middleware.Skipper
+	DB         *sqlx.DB
+	Config     libdb.Config
+	Routes     map[string]libdb.Config
+	Param      string
+	Operations map[string]string
+}
+
+// Middleware - Record audit event of every successful request, failed request (error or status >= 400) is skipped.
+// Actor read from libmiddleware.Actor when registered, otherwise from JWT claims
+func Middleware(config MiddlewareConfig) echo.MiddlewareFunc {
+	if config.Param == "" {
+		config.Param = "id"
+	}
+	if config.Operations == nil {
+		config.Operations = DefaultOperations
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			if config.Skipper != nil && config.Skipper(c) {
+				return next(c)
+			}
+			operation, ok := config.Operations[c.Request().Method]
+			if !ok {
+				return next(c)
+			}
+
+			err = next(c)
+			if err != nil || c.Response().Status >= http.StatusBadRequest {
+				return err
+			}
+			if skip, _ := c.Get(ContextSkip).(bool); skip {
+				return nil
+			}
+
+			cfg := config.Config
+			if v, ok := config.Routes[c.Path()]; ok {
+				cfg = v
+			}
+			key := c.Get(ContextKey)
+			if key == nil {
+				key = c.Param(config.Param)
+			}
+
+			// Soft delete table never hard deletes on DELETE, keep history replayable
+			if operation == "delete" && cfg.SoftDelete {
+				operation = "softdelete"
+			}
+
+			m := generate(cfg, c.Get(ContextChange), key, 0, "", c.Request().Method+" "+c.Path())
+			m.Operation = operation
+
+			ctx := c.Request().Context()
+			a := libactor.FromContext(ctx)
+			if a.RequestID == "" {
+				claims := libjwt.Parse(libecho.GetJWTClaims(c))
+				a = &libactor.Actor{
+					UserID:    claims.UserID,
+					TokenID:   claims.ID,
+					Access:    claims.Access,
+					IP:        libecho.GetRealIP(c),
+					UserAgent: c.Request().UserAgent(),
+				}
+			}
+			m.SetActor(a)
+
+			// Audit failure must not change response already sent
+			if errLog := m.LogContext(ctx, config.DB); errLog != nil {
+				liblogger.Log(nil, true).Errorf("Error audit middleware %s %v", m.Remark, errLog)
+			}
+			return nil
+		}
+	}
+}
@@ -14,5 +14,20 @@ type Model struct {
 	ServiceIP  string       `db:"service_ip" json:"service_ip"`
 	TokenID    string       `db:"token_id" json:"token_id"`
 	CreatedBy  int64        `db:"created_by" json:"created_by"`
+	IP         string       `db:"ip" json:"ip"`
+	UserAgent  string       `db:"user_agent" json:"user_agent"`
+	RequestID  string       `db:"request_id" json:"request_id"`
 	CreatedAt  sql.NullTime `db:"created_at" json:"created_at"`
+	PrevHash   string       `db:"prev_hash" json:"prev_hash"`
+	Hash       string       `db:"hash" json:"hash"`
+}
+
+// Checkpoint - Signed snapshot of chain head
+type Checkpoint struct {
+	ID        string       `db:"id" json:"id"`
+	ChainKey  string       `db:"chain_key" json:"chain_key"`
+	LastID    string       `db:"last_id" json:"last_id"`
+	LastHash  string       `db:"last_hash" json:"last_hash"`
+	Signature string       `db:"signature" json:"signature"`
+	CreatedAt sql.NullTime `db:"created_at" json:"created_at"`
 }
@@ -0,0 +1,118 @@
+package libaudittrail
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/helloferdie/golib/libdb"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrEmptyKey - Record key is empty or unsupported type, query would otherwise match every record of table
+var ErrEmptyKey = errors.New("Error audit trail: record key is empty")
+
+// Filter - Audit trail query filter, zero value field is ignored
+type Filter struct {
+	TableName  string
+	TableKey   string
+	ModuleName string
+	Operation  string
+	CreatedBy  int64
+	TokenID    string
+	From       time.Time
+	To         time.Time
+}
+
+// condition - Build query condition from filter
+func (f *Filter) condition() *libdb.ModelCondition {
+	mc := new(libdb.ModelCondition)
+	mc.Equal("table_name", "", f.TableName)
+	mc.Equal("table_key", "", f.TableKey)
+	mc.Equal("module_name", "", f.ModuleName)
+	mc.Equal("operation", "", f.Operation)
+	mc.Equal("created_by", "", f.CreatedBy)
+	mc.Equal("token_id", "", f.TokenID)
+	if !f.From.IsZero() {
+		mc.Query += "AND created_at >= :created_from "
+		mc.Field = append(mc.Field, "created_from")
+		mc.Value = append(mc.Value, f.From.UTC())
+	}
+	if !f.To.IsZero() {
+		mc.Query += "AND created_at < :created_to "
+		mc.Field = append(mc.Field, "created_to")
+		mc.Value = append(mc.Value, f.To.UTC())
+	}
+	return mc
+}
+
+// List - List audit records matching filter, ordered by newest first unless pagination order is set
+func List(d *sqlx.DB, f Filter, pagination *libdb.ModelPaginationRequest) ([]Model, int64, error) {
+	if pagination == nil {
+		pagination = &libdb.ModelPaginationRequest{ShowAll: true}
+	}
+	if pagination.OrderByField == "" && pagination.OrderCustom == "" {
+		pagination.OrderCustom = "ORDER BY created_at DESC, id DESC"
+	}
+
+	mc := f.condition()
+	list := []Model{}
+	total, err := libdb.List(d, TConfig, &list, mc.GetValue(), mc.Query, pagination)
+	return list, total, err
+}
+
+// ListByRecord - List history of record identified by table configuration and key
+func ListByRecord(d *sqlx.DB, cfg libdb.Config, key interface{}, pagination *libdb.ModelPaginationRequest) ([]Model, int64, error) {
+	k := formatKey(key)
+	if k == "" {
+		return nil, 0, ErrEmptyKey
+	}
+	return List(d, Filter{TableName: cfg.Table, TableKey: k}, pagination)
+}
+
+// ListByCreator - List records created by user
+func ListByCreator(d *sqlx.DB, creatorID int64, pagination *libdb.ModelPaginationRequest) ([]Model, int64, error) {
+	return List(d, Filter{CreatedBy: creatorID}, pagination)
+}
+
+// ListByToken - List records created with JWT token ID
+func ListByToken(d *sqlx.DB, tokenID string, pagination *libdb.ModelPaginationRequest) ([]Model, int64, error) {
+	return List(d, Filter{TokenID: tokenID}, pagination)
+}
+
+// ListByOperation - List records of operation within time range, zero time is unbounded
+func ListByOperation(d *sqlx.DB, operation string, from time.Time, to time.Time, pagination *libdb.ModelPaginationRequest) ([]Model, int64, error) {
+	return List(d, Filter{Operation: operation, From: from, To: to}, pagination)
+}
+
+// DecodeDiff - Decode change of update record
+func (m *Model) DecodeDiff() (libdb.Diff, error) {
+	diff := libdb.Diff{}
+	if m.Change == "" {
+		return diff, nil
+	}
+	err := decodeJSON(m.Change, &diff)
+	return diff, err
+}
+
+// DecodeChange - Decode change into libdb.Diff for update, or generic map for create and delete
+func (m *Model) DecodeChange() (interface{}, error) {
+	if m.Change == "" {
+		return nil, nil
+	}
+	if m.Operation == "update" {
+		return m.DecodeDiff()
+	}
+
+	var v interface{}
+	err := decodeJSON(m.Change, &v)
+	return v, err
+}
+
+// decodeJSON - Decode JSON keeping number as json.Number, int64 ID would lose precision as float64
+func decodeJSON(s string, v interface{}) error {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
@@ -0,0 +1,155 @@
+package libaudittrail
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/helloferdie/golib/libdb"
+	"github.com/jmoiron/sqlx"
+)
+
+// Gap - Event where history is incomplete or inconsistent
+type Gap struct {
+	ID        string    `json:"id"`
+	Operation string    `json:"operation"`
+	CreatedAt time.Time `json:"created_at"`
+	Reason    string    `json:"reason"`
+}
+
+// Snapshot - Reconstructed state of record at point in time
+//   - Exists: Record created and not permanently deleted
+//   - Deleted: Record soft deleted
+//   - Redacted: Columns whose value is masked in history, value in State is not the real value
+type Snapshot struct {
+	TableName string                 `json:"table_name"`
+	TableKey  string                 `json:"table_key"`
+	At        time.Time              `json:"at"`
+	Exists    bool                   `json:"exists"`
+	Deleted   bool                   `json:"deleted"`
+	State     map[string]interface{} `json:"state"`
+	Applied   int                    `json:"applied"`
+	LastID    string                 `json:"last_id"`
+	Redacted  []string               `json:"redacted"`
+	Gaps      []Gap                  `json:"gaps"`
+}
+
+// Reconstruct - Rebuild state of record at given time, inclusive, from its audit history
+func Reconstruct(d *sqlx.DB, cfg libdb.Config, key interface{}, at time.Time) (*Snapshot, error) {
+	k := formatKey(key)
+	if k == "" {
+		return nil, ErrEmptyKey
+	}
+	list, _, err := List(d, Filter{
+		TableName: cfg.Table,
+		TableKey:  k,
+		To:        at.Add(time.Nanosecond),
+	}, &libdb.ModelPaginationRequest{ShowAll: true, OrderCustom: "ORDER BY created_at ASC, id ASC"})
+	if err != nil {
+		return nil, err
+	}
+
+	s := Replay(list, at)
+	s.TableName = cfg.Table
+	s.TableKey = k
+	return s, nil
+}
+
+// Replay - Fold events of single record ordered by oldest first, events after given time are ignored
+func Replay(list []Model, at time.Time) *Snapshot {
+	s := &Snapshot{At: at, State: map[string]interface{}{}, Redacted: []string{}, Gaps: []Gap{}}
+	redacted := map[string]bool{}
+
+	for k := range list {
+		m := &list[k]
+		if m.CreatedAt.Valid && m.CreatedAt.Time.After(at) {
+			break
+		}
+		if m.Operation == "view" {
+			continue
+		}
+		if s.Applied == 0 && m.Operation != "create" {
+			s.gap(m, "history starts without create")
+		}
+
+		switch m.Operation {
+		case "create":
+			if s.Exists {
+				s.gap(m, "create of existing record")
+			}
+			payload := map[string]interface{}{}
+			if m.Change == "" || decodeJSON(m.Change, &payload) != nil {
+				s.gap(m, "create without payload")
+			}
+			s.State = payload
+			s.Exists = true
+			s.Deleted = false
+			for col, v := range payload {
+				if v == libdb.DiffMask {
+					redacted[col] = true
+				} else {
+					delete(redacted, col)
+				}
+			}
+		case "update":
+			diff, err := m.DecodeDiff()
+			if err != nil {
+				s.gap(m, "update with invalid diff")
+				break
+			}
+			if !s.Exists {
+				s.gap(m, "update of missing record")
+			}
+			for _, col := range diff.Columns() {
+				v := diff[col]
+				if old, ok := s.State[col]; ok && !redacted[col] && v.Old != libdb.DiffMask && !sameJSON(old, v.Old) {
+					s.gap(m, "old value of "+col+" does not match previous state")
+				}
+				s.State[col] = v.New
+				if v.New == libdb.DiffMask {
+					redacted[col] = true
+				} else {
+					delete(redacted, col)
+				}
+			}
+		case "delete":
+			if !s.Exists {
+				s.gap(m, "delete of missing record")
+			}
+			s.Exists = false
+		case "softdelete":
+			if s.Deleted {
+				s.gap(m, "softdelete of deleted record")
+			}
+			s.Deleted = true
+		case "unsoftdelete":
+			if !s.Deleted {
+				s.gap(m, "unsoftdelete of active record")
+			}
+			s.Deleted = false
+		default:
+			s.gap(m, "unknown operation")
+			continue
+		}
+		s.Applied++
+		s.LastID = m.ID
+	}
+
+	for col := range redacted {
+		s.Redacted = append(s.Redacted, col)
+	}
+	sort.Strings(s.Redacted)
+	return s
+}
+
+// gap -
+func (s *Snapshot) gap(m *Model, reason string) {
+	s.Gaps = append(s.Gaps, Gap{ID: m.ID, Operation: m.Operation, CreatedAt: m.CreatedAt.Time, Reason: reason})
+}
+
+// sameJSON - Compare values by JSON encoding, json.Number and float64 of same number are equal
+func sameJSON(a interface{}, b interface{}) bool {
+	ba, errA := json.Marshal(a)
+	bb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ba) == string(bb)
+}
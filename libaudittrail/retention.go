@@ -0,0 +1,463 @@
+package libaudittrail
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/helloferdie/golib/libdb"
+	"github.com/jmoiron/sqlx"
+)
+
+// RetentionRule - Keep duration of module and operation, empty module or operation match any
+type RetentionRule struct {
+	Module    string
+	Operation string
+	Keep      time.Duration
+}
+
+// RetentionPolicy - Retention rules, most specific rule wins (module and operation, module, operation, then Default).
+// Zero keep duration retain record forever
+type RetentionPolicy struct {
+	Rules   []RetentionRule
+	Default time.Duration
+}
+
+// LoadRetentionPolicy - Load policy from `audit_retention`, comma separated `<module>/<operation>=<days>` with `*` as wildcard,
+// e.g. `*/view=30,*/update=2555,billing/*=3650,*/*=365`
+func LoadRetentionPolicy() (RetentionPolicy, error) {
+	p := RetentionPolicy{}
+	for _, item := range strings.Split(os.Getenv("audit_retention"), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		part := strings.SplitN(item, "=", 2)
+		scope := strings.SplitN(part[0], "/", 2)
+		if len(part) != 2 || len(scope) != 2 {
+			return p, errors.New("Error audit retention: invalid rule " + item)
+		}
+		days, err := strconv.Atoi(strings.TrimSpace(part[1]))
+		if err != nil || days < 0 {
+			return p, errors.New("Error audit retention: invalid days " + item)
+		}
+
+		keep := time.Duration(days) * 24 * time.Hour
+		module := strings.TrimSpace(scope[0])
+		operation := strings.TrimSpace(scope[1])
+		if module == "*" && operation == "*" {
+			p.Default = keep
+			continue
+		}
+		if module == "*" {
+			module = ""
+		}
+		if operation == "*" {
+			operation = ""
+		}
+		p.Rules = append(p.Rules, RetentionRule{Module: module, Operation: operation, Keep: keep})
+	}
+	return p, nil
+}
+
+// Keep - Resolve keep duration of module and operation
+func (p *RetentionPolicy) Keep(module string, operation string) time.Duration {
+	best := -1
+	keep := p.Default
+	for _, r := range p.Rules {
+		if (r.Module != "" && r.Module != module) || (r.Operation != "" && r.Operation != operation) {
+			continue
+		}
+		score := 0
+		if r.Module != "" {
+			score += 2
+		}
+		if r.Operation != "" {
+			score++
+		}
+		if score > best {
+			best = score
+			keep = r.Keep
+		}
+	}
+	return keep
+}
+
+// ArchiveGroup - Archived records of module and operation, FirstID and LastID bound archived records in `created_at, id` order
+type ArchiveGroup struct {
+	Module    string    `json:"module"`
+	Operation string    `json:"operation"`
+	Cutoff    time.Time `json:"cutoff"`
+	Records   int64     `json:"records"`
+	FirstID   string    `json:"first_id,omitempty"`
+	LastID    string    `json:"last_id,omitempty"`
+	Deleted   int64     `json:"deleted"`
+}
+
+// Manifest - Archive run summary, written next to archive as `<archive>.manifest.json`
+type Manifest struct {
+	File      string         `json:"file"`
+	SHA256    string         `json:"sha256"`
+	Records   int64          `json:"records"`
+	Deleted   int64          `json:"deleted"`
+	CreatedAt time.Time      `json:"created_at"`
+	Groups    []ArchiveGroup `json:"groups"`
+}
+
+// Archiver - Archive expired records into gzip NDJSON file then delete them in batches
+//   - Dir: Archive directory, default to `audit_archive_dir` or `audit_archive` in `dir_log`
+//   - BatchSize: Records read and deleted per query, default to 1000
+type Archiver struct {
+	DB        *sqlx.DB
+	Policy    RetentionPolicy
+	Dir       string
+	BatchSize int
+}
+
+// archiveGroupRow -
+type archiveGroupRow struct {
+	Module    string `db:"module_name"`
+	Operation string `db:"operation"`
+}
+
+// Run - Archive and delete every record past retention, records are deleted only after archive and manifest are synced.
+// Only records read back from archive file are deleted, record expired after archive is left for next run
+func (a *Archiver) Run(ctx context.Context) (*Manifest, error) {
+	if a.BatchSize <= 0 {
+		a.BatchSize = 1000
+	}
+	dir := a.Dir
+	if dir == "" {
+		dir = os.Getenv("audit_archive_dir")
+	}
+	if dir == "" {
+		dir = os.Getenv("dir_log")
+		if dir == "" {
+			dir = "."
+		}
+		dir += "/audit_archive"
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	manifest := &Manifest{
+		File:      filepath.Join(dir, "audit_"+now.Format("20060102T150405")+".ndjson.gz"),
+		CreatedAt: now,
+		Groups:    []ArchiveGroup{},
+	}
+
+	// Resolve cutoff of every module and operation pair
+	rows := []archiveGroupRow{}
+	err := libdb.Select(a.DB, &rows, "SELECT DISTINCT module_name, operation FROM "+TConfig.Table, map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		keep := a.Policy.Keep(r.Module, r.Operation)
+		if keep <= 0 {
+			continue
+		}
+		manifest.Groups = append(manifest.Groups, ArchiveGroup{Module: r.Module, Operation: r.Operation, Cutoff: now.Add(-keep)})
+	}
+	if len(manifest.Groups) == 0 {
+		return manifest, nil
+	}
+
+	// Phase 1, archive
+	err = a.archive(ctx, manifest)
+	if err != nil {
+		os.Remove(manifest.File)
+		return nil, err
+	}
+	if manifest.Records == 0 {
+		os.Remove(manifest.File)
+		return manifest, nil
+	}
+	err = writeManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	// Phase 2, delete archived records
+	err = a.delete(ctx, manifest)
+	if err != nil {
+		writeManifest(manifest)
+		return manifest, err
+	}
+	return manifest, writeManifest(manifest)
+}
+
+// groupCondition - Condition of expired records of group
+func groupCondition(g *ArchiveGroup) (string, map[string]interface{}) {
+	return "AND module_name = :module_name AND operation = :operation AND created_at < :cutoff ", map[string]interface{}{
+		"module_name": g.Module,
+		"operation":   g.Operation,
+		"cutoff":      g.Cutoff,
+	}
+}
+
+// archive - Stream expired records of every group into archive file
+func (a *Archiver) archive(ctx context.Context, manifest *Manifest) error {
+	f, err := os.OpenFile(manifest.File, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	buf := bufio.NewWriter(io.MultiWriter(f, h))
+	gz := gzip.NewWriter(buf)
+	enc := json.NewEncoder(gz)
+
+	for k := range manifest.Groups {
+		g := &manifest.Groups[k]
+		condition, values := groupCondition(g)
+		afterID := ""
+		var afterAt time.Time
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			query := "SELECT " + TConfig.Fields + " FROM " + TConfig.Table + " WHERE 1=1 " + condition
+			if afterID != "" {
+				query += "AND (created_at > :after_at OR (created_at = :after_at AND id > :after_id)) "
+				values["after_at"] = afterAt
+				values["after_id"] = afterID
+			}
+			query += "ORDER BY created_at ASC, id ASC LIMIT " + strconv.Itoa(a.BatchSize)
+
+			list := []Model{}
+			err := libdb.Select(a.DB, &list, query, values)
+			if err != nil {
+				return err
+			}
+			for k := range list {
+				if err := enc.Encode(&list[k]); err != nil {
+					return err
+				}
+				if g.FirstID == "" {
+					g.FirstID = list[k].ID
+				}
+				g.LastID = list[k].ID
+			}
+			g.Records += int64(len(list))
+			manifest.Records += int64(len(list))
+
+			if len(list) < a.BatchSize {
+				break
+			}
+			afterAt = list[len(list)-1].CreatedAt.Time
+			afterID = list[len(list)-1].ID
+		}
+	}
+
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	manifest.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+// delete - Delete records read back from archive file in batches, records of each group are contiguous in archive
+func (a *Archiver) delete(ctx context.Context, manifest *Manifest) error {
+	f, err := os.Open(manifest.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	group := map[string]*ArchiveGroup{}
+	for k := range manifest.Groups {
+		g := &manifest.Groups[k]
+		group[g.Module+"/"+g.Operation] = g
+	}
+
+	var current *ArchiveGroup
+	ids := []string{}
+	flush := func() error {
+		if len(ids) == 0 {
+			return nil
+		}
+		dv := map[string]interface{}{}
+		res, err := a.DB.NamedExecContext(ctx, "DELETE FROM "+TConfig.Table+" WHERE 1=1 "+libdb.PrepareInQuery("AND id IN", "id", ids, dv), dv)
+		if err != nil {
+			return err
+		}
+		n, _ := res.RowsAffected()
+		current.Deleted += n
+		manifest.Deleted += n
+		ids = ids[:0]
+		return nil
+	}
+
+	dec := json.NewDecoder(gz)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		m := new(Model)
+		err := dec.Decode(m)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		g, ok := group[m.ModuleName+"/"+m.Operation]
+		if !ok {
+			return errors.New("Error audit archive: record " + m.ID + " has no group")
+		}
+		if g != current || len(ids) >= a.BatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+			current = g
+		}
+		ids = append(ids, m.ID)
+	}
+	return flush()
+}
+
+// writeManifest - Write manifest atomically next to archive
+func writeManifest(m *Manifest) error {
+	bt, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.File + ".manifest.json.tmp"
+	if err := os.WriteFile(tmp, bt, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.File+".manifest.json")
+}
+
+// Partitioner - Manage monthly range partitions of MySQL audit_trail table partitioned by `TO_DAYS(created_at)`,
+// created_at must be part of primary key
+//   - Ahead: Months created ahead of current month, default to 3
+type Partitioner struct {
+	DB    *sqlx.DB
+	Ahead int
+}
+
+// partitionRow -
+type partitionRow struct {
+	Name        string `db:"PARTITION_NAME"`
+	Description string `db:"PARTITION_DESCRIPTION"`
+}
+
+// partitionName - Partition name of month, e.g. p202610
+func partitionName(t time.Time) string {
+	return "p" + t.Format("200601")
+}
+
+// list - List existing partition of table
+func (p *Partitioner) list() ([]partitionRow, error) {
+	if p.DB.DriverName() != "mysql" {
+		return nil, errors.New("Error audit partition: only mysql is supported")
+	}
+	list := []partitionRow{}
+	err := libdb.Select(p.DB, &list, "SELECT PARTITION_NAME, PARTITION_DESCRIPTION FROM information_schema.PARTITIONS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = :table AND PARTITION_NAME IS NOT NULL ORDER BY PARTITION_ORDINAL_POSITION", map[string]interface{}{
+		"table": TConfig.Table,
+	})
+	return list, err
+}
+
+// Ensure - Create missing monthly partition from current month until Ahead months, `pmax` catch-all partition is split when exist
+func (p *Partitioner) Ensure(ctx context.Context) ([]string, error) {
+	if p.Ahead <= 0 {
+		p.Ahead = 3
+	}
+	list, err := p.list()
+	if err != nil {
+		return nil, err
+	}
+	exist := map[string]bool{}
+	for _, r := range list {
+		exist[r.Name] = true
+	}
+
+	now := time.Now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	def := []string{}
+	created := []string{}
+	for i := 0; i <= p.Ahead; i++ {
+		t := month.AddDate(0, i, 0)
+		name := partitionName(t)
+		if exist[name] {
+			continue
+		}
+		def = append(def, fmt.Sprintf("PARTITION %s VALUES LESS THAN (TO_DAYS('%s'))", name, t.AddDate(0, 1, 0).Format("2006-01-02")))
+		created = append(created, name)
+	}
+	if len(def) == 0 {
+		return created, nil
+	}
+
+	query := "ALTER TABLE " + TConfig.Table + " ADD PARTITION (" + strings.Join(def, ", ") + ")"
+	if exist["pmax"] {
+		def = append(def, "PARTITION pmax VALUES LESS THAN MAXVALUE")
+		query = "ALTER TABLE " + TConfig.Table + " REORGANIZE PARTITION pmax INTO (" + strings.Join(def, ", ") + ")"
+	}
+	_, err = p.DB.ExecContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// DropEmpty - Drop monthly partition ending before given time, only when empty so archive with Archiver first
+func (p *Partitioner) DropEmpty(ctx context.Context, before time.Time) ([]string, error) {
+	list, err := p.list()
+	if err != nil {
+		return nil, err
+	}
+
+	dropped := []string{}
+	for _, r := range list {
+		t, err := time.Parse("200601", strings.TrimPrefix(r.Name, "p"))
+		if err != nil || t.AddDate(0, 1, 0).After(before) {
+			continue
+		}
+
+		var total int64
+		err = p.DB.QueryRowxContext(ctx, "SELECT COUNT(*) FROM "+TConfig.Table+" PARTITION ("+r.Name+")").Scan(&total)
+		if err != nil {
+			return dropped, err
+		}
+		if total > 0 {
+			continue
+		}
+		_, err = p.DB.ExecContext(ctx, "ALTER TABLE "+TConfig.Table+" DROP PARTITION "+r.Name)
+		if err != nil {
+			return dropped, err
+		}
+		dropped = append(dropped, r.Name)
+	}
+	return dropped, nil
+}
@@ -0,0 +1,189 @@
+package libaudittrail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/helloferdie/golib/libdb"
+	"github.com/helloferdie/golib/libredis"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Sink - Destination of audit records
+type Sink interface {
+	Write(ctx context.Context, list []*Model) error
+}
+
+var sinkMu sync.RWMutex
+var defaultSink Sink
+
+// UseSink - Register sink used by Log and Writer instead of audit_trail table, set nil to restore
+func UseSink(s Sink) {
+	sinkMu.Lock()
+	defer sinkMu.Unlock()
+	defaultSink = s
+}
+
+// getSink - Get registered sink, default to SQL table on given connection
+func getSink(d *sqlx.DB) Sink {
+	sinkMu.RLock()
+	defer sinkMu.RUnlock()
+	if defaultSink != nil {
+		return defaultSink
+	}
+	return &SQLSink{DB: d}
+}
+
+// SQLSink - Write records into audit_trail table
+type SQLSink struct {
+	DB *sqlx.DB
+}
+
+// Write -
+func (s *SQLSink) Write(ctx context.Context, list []*Model) error {
+	if len(list) == 1 {
+		return libdb.Create(s.DB, TConfig, list[0], dbMode, false)
+	}
+	return libdb.CreateBulk(s.DB, TConfig, list, dbMode)
+}
+
+// JSONSink - Write records as JSON lines into writer
+type JSONSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONSink -
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{w: w}
+}
+
+// NewStdoutSink - Write records as JSON lines into stdout
+func NewStdoutSink() *JSONSink {
+	return NewJSONSink(os.Stdout)
+}
+
+// NewFileSink - Write records as JSON lines into rotating file
+func NewFileSink(filename string, maxSizeMB int, maxBackups int, maxAgeDays int) *JSONSink {
+	return NewJSONSink(&lumberjack.Logger{
+		Filename:   filename,
+		MaxSize:    maxSizeMB,
+		MaxBackups: maxBackups,
+		MaxAge:     maxAgeDays,
+		Compress:   true,
+	})
+}
+
+// Write -
+func (s *JSONSink) Write(ctx context.Context, list []*Model) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enc := json.NewEncoder(s.w)
+	for _, m := range list {
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RedisSink - Write records into redis stream
+type RedisSink struct {
+	Client *libredis.Client
+	Stream string
+	MaxLen int64
+}
+
+// Write -
+func (s *RedisSink) Write(ctx context.Context, list []*Model) error {
+	for _, m := range list {
+		bt, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		_, err = s.Client.XAddContext(ctx, s.Stream, map[string]interface{}{
+			"id":     m.ID,
+			"record": string(bt),
+		}, s.MaxLen)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MultiSink - Write records into every sink, return joined error of failed sinks
+type MultiSink []Sink
+
+// Write -
+func (ms MultiSink) Write(ctx context.Context, list []*Model) error {
+	var errs []error
+	for _, s := range ms {
+		if err := s.Write(ctx, list); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LoadSink - Build sink from environment
+//   - audit_sink: Comma separated `sql`, `file`, `stdout`, `redis`, default to `sql`
+//   - audit_sink_file: File path for `file`, default to `audit.log` in `dir_log`
+//   - audit_sink_file_max_size: Rotate size in megabytes, default to 500
+//   - audit_sink_redis_stream: Stream name for `redis`, default to `audit_trail`
+//   - audit_sink_redis_max_len: Approximate stream max length, default unlimited
+func LoadSink(d *sqlx.DB) (Sink, error) {
+	names := os.Getenv("audit_sink")
+	if names == "" {
+		names = "sql"
+	}
+
+	ms := MultiSink{}
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "sql":
+			ms = append(ms, &SQLSink{DB: d})
+		case "stdout":
+			ms = append(ms, NewStdoutSink())
+		case "file":
+			file := os.Getenv("audit_sink_file")
+			if file == "" {
+				dir := os.Getenv("dir_log")
+				if dir == "" {
+					dir = "."
+				}
+				file = dir + "/audit.log"
+			}
+			size, err := strconv.Atoi(os.Getenv("audit_sink_file_max_size"))
+			if err != nil || size <= 0 {
+				size = 500
+			}
+			ms = append(ms, NewFileSink(file, size, 0, 0))
+		case "redis":
+			stream := os.Getenv("audit_sink_redis_stream")
+			if stream == "" {
+				stream = "audit_trail"
+			}
+			maxLen, _ := strconv.ParseInt(os.Getenv("audit_sink_redis_max_len"), 10, 64)
+			cl := new(libredis.Client)
+			cl.Initialize()
+			ms = append(ms, &RedisSink{Client: cl, Stream: stream, MaxLen: maxLen})
+		case "":
+		default:
+			return nil, errors.New("Error audit sink: unsupported sink " + name)
+		}
+	}
+
+	if len(ms) == 1 {
+		return ms[0], nil
+	}
+	return ms, nil
+}
@@ -0,0 +1,71 @@
+package libaudittrail
+
+import (
+	"context"
+
+	"github.com/helloferdie/golib/libactor"
+	"github.com/helloferdie/golib/libdb"
+	"github.com/jmoiron/sqlx"
+)
+
+// TxLog - Write record into audit_trail table within caller transaction, bypass registered sink and writer
+// so record is committed or rolled back together with business change
+func (m *Model) TxLog(tx *sqlx.Tx) error {
+	if err := m.prepare(); err != nil {
+		return err
+	}
+	if c := getChain(); c != nil {
+		if err := c.SealTx(tx, m); err != nil {
+			return err
+		}
+	}
+	return libdb.TxCreate(tx, TConfig, m, dbMode, false)
+}
+
+// TxLogContext - Write record within caller transaction, actor read from context
+func (m *Model) TxLogContext(ctx context.Context, tx *sqlx.Tx) error {
+	m.SetActor(libactor.FromContext(ctx))
+	return m.TxLog(tx)
+}
+
+// TxLogCreate - Create record within transaction
+func TxLogCreate(tx *sqlx.Tx, cfg libdb.Config, dt interface{}, key interface{}, creatorID int64, tokenID string, remark string) error {
+	m := PrepareLogCreate(cfg, dt, key, creatorID, tokenID, remark)
+	err := m.TxLog(tx)
+	return err
+}
+
+// TxLogUpdate - Update record within transaction
+func TxLogUpdate(tx *sqlx.Tx, cfg libdb.Config, dt interface{}, key interface{}, creatorID int64, tokenID string, remark string) error {
+	m := PrepareLogUpdate(cfg, dt, key, creatorID, tokenID, remark)
+	err := m.TxLog(tx)
+	return err
+}
+
+// TxLogDelete - Permanently delete record within transaction
+func TxLogDelete(tx *sqlx.Tx, cfg libdb.Config, dt interface{}, key interface{}, creatorID int64, tokenID string, remark string) error {
+	m := PrepareLogDelete(cfg, dt, key, creatorID, tokenID, remark)
+	err := m.TxLog(tx)
+	return err
+}
+
+// TxLogSoftDelete - Soft delete record within transaction
+func TxLogSoftDelete(tx *sqlx.Tx, cfg libdb.Config, key interface{}, creatorID int64, tokenID string, remark string) error {
+	m := PrepareLogSoftDelete(cfg, key, creatorID, tokenID, remark)
+	err := m.TxLog(tx)
+	return err
+}
+
+// TxLogUnsoftDelete - Revert soft delete record within transaction
+func TxLogUnsoftDelete(tx *sqlx.Tx, cfg libdb.Config, key interface{}, creatorID int64, tokenID string, remark string) error {
+	m := PrepareLogUnsoftDelete(cfg, key, creatorID, tokenID, remark)
+	err := m.TxLog(tx)
+	return err
+}
+
+// TxLogView - View record within transaction
+func TxLogView(tx *sqlx.Tx, cfg libdb.Config, key interface{}, creatorID int64, tokenID string, remark string) error {
+	m := PrepareLogView(cfg, key, creatorID, tokenID, remark)
+	err := m.TxLog(tx)
+	return err
+}
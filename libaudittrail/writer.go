@@ -0,0 +1,254 @@
+package libaudittrail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/helloferdie/golib/liblogger"
+	"github.com/jmoiron/sqlx"
+)
+
+// Overflow policy when writer buffer is full
+const (
+	OverflowBlock = "block"
+	OverflowDrop  = "drop"
+	OverflowSpill = "spill"
+)
+
+// ErrWriterClosed - Writer already closed
+var ErrWriterClosed = errors.New("Error audit writer: closed")
+
+// ErrWriterDropped - Record dropped because buffer is full
+var ErrWriterDropped = errors.New("Error audit writer: buffer full, record dropped")
+
+var writerMu sync.RWMutex
+var defaultWriter *Writer
+
+// UseWriter - Register asynchronous writer used by Log, set nil to write synchronously
+func UseWriter(w *Writer) {
+	writerMu.Lock()
+	defer writerMu.Unlock()
+	defaultWriter = w
+}
+
+// getWriter -
+func getWriter() *Writer {
+	writerMu.RLock()
+	defer writerMu.RUnlock()
+	return defaultWriter
+}
+
+// WriterConfig - Asynchronous writer configuration
+//   - BufferSize: Maximum queued records, default to 10000
+//   - BatchSize: Maximum records per bulk insert, default to 100
+//   - FlushInterval: Flush queued records at least every interval, default to 1 second
+//   - Overflow: OverflowBlock, OverflowDrop (default) or OverflowSpill
+//   - SpillFile: JSON lines file used by OverflowSpill and failed batch, default to `audit_spill.log` in `dir_log`
+//   - Sink: Destination of batch, default to sink registered with UseSink or audit_trail table
+type WriterConfig struct {
+	Sink          Sink
+	BufferSize    int
+	BatchSize     int
+	FlushInterval time.Duration
+	Overflow      string
+	SpillFile     string
+}
+
+// WriterStats - Asynchronous writer counters
+type WriterStats struct {
+	Queued  int64 `json:"queued"`
+	Written int64 `json:"written"`
+	Dropped int64 `json:"dropped"`
+	Spilled int64 `json:"spilled"`
+	Failed  int64 `json:"failed"`
+}
+
+// Writer - Asynchronous batched audit writer
+type Writer struct {
+	cfg WriterConfig
+	ch  chan *Model
+
+	mu      sync.RWMutex
+	closed  bool
+	done    chan struct{}
+	spillMu sync.Mutex
+
+	queued  int64
+	written int64
+	dropped int64
+	spilled int64
+	failed  int64
+}
+
+// NewWriter - Create and start asynchronous writer
+func NewWriter(d *sqlx.DB, cfg WriterConfig) *Writer {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 10000
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.Overflow == "" {
+		cfg.Overflow = OverflowDrop
+	}
+	if cfg.Sink == nil {
+		cfg.Sink = getSink(d)
+	}
+	if cfg.SpillFile == "" {
+		dir := os.Getenv("dir_log")
+		if dir == "" {
+			dir = "."
+		}
+		cfg.SpillFile = dir + "/audit_spill.log"
+	}
+
+	w := &Writer{
+		cfg:  cfg,
+		ch:   make(chan *Model, cfg.BufferSize),
+		done: make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Write - Queue prepared record, behaviour on full buffer follows overflow policy
+func (w *Writer) Write(m *Model) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrWriterClosed
+	}
+
+	select {
+	case w.ch <- m:
+		atomic.AddInt64(&w.queued, 1)
+		return nil
+	default:
+	}
+
+	switch w.cfg.Overflow {
+	case OverflowBlock:
+		w.ch <- m
+		atomic.AddInt64(&w.queued, 1)
+		return nil
+	case OverflowSpill:
+		return w.spill([]*Model{m})
+	}
+	atomic.AddInt64(&w.dropped, 1)
+	return ErrWriterDropped
+}
+
+// Stats - Get writer counters
+func (w *Writer) Stats() WriterStats {
+	return WriterStats{
+		Queued:  atomic.LoadInt64(&w.queued),
+		Written: atomic.LoadInt64(&w.written),
+		Dropped: atomic.LoadInt64(&w.dropped),
+		Spilled: atomic.LoadInt64(&w.spilled),
+		Failed:  atomic.LoadInt64(&w.failed),
+	}
+}
+
+// Close - Stop accepting record and flush queued records, wait until done or context cancelled
+func (w *Writer) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.ch)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run -
+func (w *Writer) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Model, 0, w.cfg.BatchSize)
+	for {
+		select {
+		case m, ok := <-w.ch:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			batch = append(batch, m)
+			if len(batch) >= w.cfg.BatchSize {
+				w.flush(batch)
+				batch = make([]*Model, 0, w.cfg.BatchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				w.flush(batch)
+				batch = make([]*Model, 0, w.cfg.BatchSize)
+			}
+		}
+	}
+}
+
+// flush - Write batch into sink, spill to file when write failed
+func (w *Writer) flush(batch []*Model) {
+	if len(batch) == 0 {
+		return
+	}
+	atomic.AddInt64(&w.queued, -int64(len(batch)))
+
+	// Seal in writer goroutine so chain head only advances once batch is stored, timestamp and ID reassigned on seal
+	write := func(list []*Model) error {
+		return w.cfg.Sink.Write(context.Background(), list)
+	}
+	var err error
+	if c := getChain(); c != nil {
+		err = c.WriteSealed(batch, write)
+	} else {
+		err = write(batch)
+	}
+	if err == nil {
+		atomic.AddInt64(&w.written, int64(len(batch)))
+		return
+	}
+
+	liblogger.Log(nil, true).Errorf("Error audit writer flush %d records %v", len(batch), err)
+	if w.spill(batch) != nil {
+		atomic.AddInt64(&w.failed, int64(len(batch)))
+	}
+}
+
+// spill - Append records to spill file as JSON lines
+func (w *Writer) spill(list []*Model) error {
+	w.spillMu.Lock()
+	defer w.spillMu.Unlock()
+
+	f, err := os.OpenFile(w.cfg.SpillFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		liblogger.Log(nil, true).Errorf("Error audit writer spill %v", err)
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, m := range list {
+		if err := enc.Encode(m); err != nil {
+			liblogger.Log(nil, true).Errorf("Error audit writer spill %v", err)
+			return err
+		}
+	}
+	atomic.AddInt64(&w.spilled, int64(len(list)))
+	return nil
+}
@@ -0,0 +1,180 @@
+package libdb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/helloferdie/golib/liblogger"
+	"github.com/helloferdie/golib/libtime"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// GroupBy - Group by column, optional date truncation in app timezone
+//   - Truncate: Empty, `day`, `week` (start on monday) or `month`, result formatted as yyyy-mm-dd
+//   - Alias: Result column name, default to column name without table prefix
+type GroupBy struct {
+	Column   string
+	Truncate string
+	Alias    string
+}
+
+// Aggregation - Aggregate function over column
+//   - Func: `count`, `sum`, `avg`, `min` or `max`
+//   - Column: Column name, empty for count(*)
+type Aggregation struct {
+	Func   string
+	Column string
+	Alias  string
+}
+
+// Count -
+func Count(alias string) Aggregation {
+	return Aggregation{Func: "count", Alias: alias}
+}
+
+// Sum -
+func Sum(column string, alias string) Aggregation {
+	return Aggregation{Func: "sum", Column: column, Alias: alias}
+}
+
+// Avg -
+func Avg(column string, alias string) Aggregation {
+	return Aggregation{Func: "avg", Column: column, Alias: alias}
+}
+
+// Min -
+func Min(column string, alias string) Aggregation {
+	return Aggregation{Func: "min", Column: column, Alias: alias}
+}
+
+// Max -
+func Max(column string, alias string) Aggregation {
+	return Aggregation{Func: "max", Column: column, Alias: alias}
+}
+
+// PrepareAggregate - Prepare aggregate query with soft delete condition applied
+func PrepareAggregate(driver string, cfg Config, mc *ModelCondition, group []GroupBy, agg []Aggregation) (string, map[string]interface{}, error) {
+	if len(agg) == 0 {
+		return "", nil, fmt.Errorf("Error prepare aggregate: aggregation is empty")
+	}
+
+	var sel, pos []string
+	values := map[string]interface{}{}
+	aliases := map[string]bool{}
+	for k, g := range group {
+		expr, err := truncateDate(driver, g.Column, g.Truncate, values)
+		if err != nil {
+			return "", nil, err
+		}
+		alias := g.Alias
+		if alias == "" {
+			alias = g.Column[strings.LastIndex(g.Column, ".")+1:]
+		}
+		if aliases[alias] {
+			return "", nil, fmt.Errorf("Error prepare aggregate: duplicate alias %s", alias)
+		}
+		aliases[alias] = true
+		sel = append(sel, expr+" AS "+alias)
+		pos = append(pos, strconv.Itoa(k+1))
+	}
+
+	for _, a := range agg {
+		fn := strings.ToLower(a.Func)
+		switch fn {
+		case "count", "sum", "avg", "min", "max":
+		default:
+			return "", nil, fmt.Errorf("Error prepare aggregate: function %s not supported", a.Func)
+		}
+
+		column := a.Column
+		if column == "" {
+			if fn != "count" {
+				return "", nil, fmt.Errorf("Error prepare aggregate: column required for %s", fn)
+			}
+			column = "*"
+		}
+		alias := a.Alias
+		if alias == "" {
+			alias = fn
+		}
+		if aliases[alias] {
+			return "", nil, fmt.Errorf("Error prepare aggregate: duplicate alias %s", alias)
+		}
+		aliases[alias] = true
+		sel = append(sel, strings.ToUpper(fn)+"("+column+") AS "+alias)
+	}
+
+	condition := cfg.GetConditionSoftDelete()
+	if mc != nil {
+		condition += mc.Query
+		for k, v := range mc.GetValue() {
+			values[k] = v
+		}
+	}
+
+	query := "SELECT " + strings.Join(sel, ", ") + " FROM " + cfg.Table + " WHERE 1=1 " + condition
+	if len(pos) > 0 {
+		query += "GROUP BY " + strings.Join(pos, ", ") + " ORDER BY " + strings.Join(pos, ", ")
+	}
+	return query, values, nil
+}
+
+// truncateDate - Build date truncation expression converted into app timezone, timezone offset added to values
+// as bound parameter since named query parser does not skip colon inside string literal
+func truncateDate(driver string, column string, truncate string, values map[string]interface{}) (string, error) {
+	if truncate == "" {
+		return column, nil
+	}
+
+	loc := libtime.Location()
+	if driver == "postgres" {
+		local := "(" + column + " AT TIME ZONE 'UTC' AT TIME ZONE '" + loc.String() + "')"
+		switch truncate {
+		case "day", "week", "month":
+			return "TO_CHAR(DATE_TRUNC('" + truncate + "', " + local + "), 'YYYY-MM-DD')", nil
+		}
+		return "", fmt.Errorf("Error prepare aggregate: truncate %s not supported", truncate)
+	}
+
+	// MySQL named timezone requires timezone tables, use current offset of app timezone
+	_, offset := time.Now().In(loc).Zone()
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	tz := fmt.Sprintf("%s%02d:%02d", sign, offset/3600, (offset%3600)/60)
+	values["aggregate_tz_utc"] = "+00:00"
+	values["aggregate_tz_app"] = tz
+	local := "CONVERT_TZ(" + column + ", :aggregate_tz_utc, :aggregate_tz_app)"
+	switch truncate {
+	case "day":
+		return "DATE_FORMAT(" + local + ", '%Y-%m-%d')", nil
+	case "week":
+		return "DATE_FORMAT(DATE_SUB(" + local + ", INTERVAL WEEKDAY(" + local + ") DAY), '%Y-%m-%d')", nil
+	case "month":
+		return "DATE_FORMAT(" + local + ", '%Y-%m-01')", nil
+	}
+	return "", fmt.Errorf("Error prepare aggregate: truncate %s not supported", truncate)
+}
+
+// Aggregate - Select aggregate rows into list, list must be pointer to slice of struct with db tag matching alias
+func Aggregate(d *sqlx.DB, cfg Config, list interface{}, mc *ModelCondition, group []GroupBy, agg []Aggregation) error {
+	query, values, err := PrepareAggregate(d.DriverName(), cfg, mc, group, agg)
+	if err != nil {
+		liblogger.Log(nil, true).Error(err)
+		return err
+	}
+	return Select(d, list, query, values)
+}
+
+// Summary - Count total rows per group into ModelSummary
+func Summary(d *sqlx.DB, cfg Config, mc *ModelCondition, group GroupBy) ([]ModelSummary, error) {
+	list := []ModelSummary{}
+	group.Alias = "label"
+	err := Aggregate(d, cfg, &list, mc, []GroupBy{group}, []Aggregation{Count("total")})
+	return list, err
+}
@@ -0,0 +1,77 @@
+package libdb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestPrepareAggregate(t *testing.T) {
+	t.Setenv("app_timezone", "Asia/Jakarta")
+	cfg := Config{Table: "orders", SoftDelete: true}
+	mysqlTZ := map[string]interface{}{"aggregate_tz_utc": "+00:00", "aggregate_tz_app": "+07:00"}
+
+	cases := []struct {
+		driver   string
+		truncate string
+		expr     string
+		tz       bool
+	}{
+		{"mysql", "", "created_at", false},
+		{"mysql", "day", "DATE_FORMAT(CONVERT_TZ(created_at, :aggregate_tz_utc, :aggregate_tz_app), '%Y-%m-%d')", true},
+		{"mysql", "week", "DATE_FORMAT(DATE_SUB(CONVERT_TZ(created_at, :aggregate_tz_utc, :aggregate_tz_app), INTERVAL WEEKDAY(CONVERT_TZ(created_at, :aggregate_tz_utc, :aggregate_tz_app)) DAY), '%Y-%m-%d')", true},
+		{"mysql", "month", "DATE_FORMAT(CONVERT_TZ(created_at, :aggregate_tz_utc, :aggregate_tz_app), '%Y-%m-01')", true},
+		{"postgres", "", "created_at", false},
+		{"postgres", "day", "TO_CHAR(DATE_TRUNC('day', (created_at AT TIME ZONE 'UTC' AT TIME ZONE 'Asia/Jakarta')), 'YYYY-MM-DD')", false},
+		{"postgres", "week", "TO_CHAR(DATE_TRUNC('week', (created_at AT TIME ZONE 'UTC' AT TIME ZONE 'Asia/Jakarta')), 'YYYY-MM-DD')", false},
+		{"postgres", "month", "TO_CHAR(DATE_TRUNC('month', (created_at AT TIME ZONE 'UTC' AT TIME ZONE 'Asia/Jakarta')), 'YYYY-MM-DD')", false},
+	}
+	for _, c := range cases {
+		mc := new(ModelCondition)
+		mc.Equal("status", "", "paid")
+
+		query, values, err := PrepareAggregate(c.driver, cfg, mc, []GroupBy{{Column: "created_at", Truncate: c.truncate}}, []Aggregation{Count("total"), Sum("amount", "amount")})
+		if err != nil {
+			t.Fatalf("%s %s: %v", c.driver, c.truncate, err)
+		}
+
+		expected := "SELECT " + c.expr + " AS created_at, COUNT(*) AS total, SUM(amount) AS amount FROM orders WHERE 1=1 AND deleted_at IS NULL AND status = :status GROUP BY 1 ORDER BY 1"
+		if query != expected {
+			t.Fatalf("%s %s: query\n%s\nexpected\n%s", c.driver, c.truncate, query, expected)
+		}
+		expectedValues := map[string]interface{}{"status": "paid"}
+		if c.tz {
+			for k, v := range mysqlTZ {
+				expectedValues[k] = v
+			}
+		}
+		if !reflect.DeepEqual(values, expectedValues) {
+			t.Fatalf("%s %s: values %v expected %v", c.driver, c.truncate, values, expectedValues)
+		}
+		if _, _, err := sqlx.Named(query, values); err != nil {
+			t.Fatalf("%s %s: named query %v", c.driver, c.truncate, err)
+		}
+	}
+}
+
+func TestPrepareAggregateAlias(t *testing.T) {
+	cfg := Config{Table: "orders"}
+	query, _, err := PrepareAggregate("mysql", cfg, nil, []GroupBy{{Column: "o.status"}, {Column: "o.channel"}}, []Aggregation{Count("")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "SELECT o.status AS status, o.channel AS channel, COUNT(*) AS count FROM orders WHERE 1=1 GROUP BY 1, 2 ORDER BY 1, 2"
+	if query != expected {
+		t.Fatalf("query\n%s\nexpected\n%s", query, expected)
+	}
+
+	_, _, err = PrepareAggregate("mysql", cfg, nil, []GroupBy{{Column: "status"}, {Column: "channel", Alias: "status"}}, []Aggregation{Count("")})
+	if err == nil {
+		t.Fatal("duplicate group alias accepted")
+	}
+	_, _, err = PrepareAggregate("mysql", cfg, nil, []GroupBy{{Column: "total"}}, []Aggregation{Count("total")})
+	if err == nil {
+		t.Fatal("duplicate aggregation alias accepted")
+	}
+}
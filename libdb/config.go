@@ -1,13 +1,27 @@
 package libdb
 
-import "database/sql"
+import (
+	"database/sql"
+
+	"github.com/helloferdie/golib/libid"
+)
 
 // Config - Database table configuration
+//   - IDColumn: Column assigned automatically on create when empty and always inserted regardless of Mode, e.g. `uuid`
+//   - IDGenerator: Generator for IDColumn, default to UUIDv4 when IDColumn is set, libid.SonyflakeID for numeric ID
+//   - Differ: Differ used by update to detect changed columns, default to DefaultDiffer
+//   - History: Copy prior version of row into `<table>_history` on update and delete
+//   - Redactor: Redaction rules of audit payload including update diff, default to DefaultRedactor
 type Config struct {
-	Table      string
-	Fields     string
-	SoftDelete bool
-	Module     string
+	Table       string
+	Fields      string
+	SoftDelete  bool
+	Module      string
+	IDColumn    string
+	IDGenerator libid.Generator
+	Differ      *Differ
+	History     bool
+	Redactor    *Redactor
 }
 
 // GetConditionSoftDelete - Get condition for soft delete
@@ -25,6 +39,13 @@ type ModelTimestamp struct {
 	DeletedAt sql.NullTime `db:"deleted_at" json:"deleted_at"`
 }
 
+// ModelHistory - General struct for history table columns
+type ModelHistory struct {
+	ValidFrom        sql.NullTime `db:"valid_from" json:"valid_from"`
+	ValidTo          sql.NullTime `db:"valid_to" json:"valid_to"`
+	HistoryOperation string       `db:"history_operation" json:"history_operation"`
+}
+
 // ModelID - General struct for query ID primary key
 type ModelID struct {
 	ID int64 `db:"id"`
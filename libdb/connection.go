@@ -1,10 +1,16 @@
 package libdb
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/helloferdie/golib/liblogger"
+	"github.com/helloferdie/golib/libsecret"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
@@ -18,6 +24,8 @@ type Connection struct {
 
 // cacheConnection - Cache connection string in memory
 var cacheConnection = map[string]*Connection{}
+var cacheConnectionMu sync.Mutex
+var watchConnection = map[string]bool{}
 
 // setConnection - Set connection string
 func setConnection(env string) (*Connection, error) {
@@ -25,13 +33,15 @@ func setConnection(env string) (*Connection, error) {
 		env = "db"
 	}
 
+	cacheConnectionMu.Lock()
+	defer cacheConnectionMu.Unlock()
 	v, ok := cacheConnection[env]
 	if !ok {
 		driver := os.Getenv(env + "_driver")
 		host := os.Getenv(env + "_host")
 		port := os.Getenv(env + "_port")
 		user := os.Getenv(env + "_user")
-		pass := os.Getenv(env + "_pass")
+		pass := libsecret.Get(env + "_pass")
 		dbname := os.Getenv(env + "_name")
 
 		if driver == "mysql" {
@@ -50,6 +60,16 @@ func setConnection(env string) (*Connection, error) {
 				Driver: driver,
 				DSN:    cfg.FormatDSN(),
 			}
+
+			// Rebuild connection string for next physical connection once password rotated
+			if !watchConnection[env] {
+				libsecret.OnChange(env+"_pass", func(string) {
+					cacheConnectionMu.Lock()
+					defer cacheConnectionMu.Unlock()
+					delete(cacheConnection, env)
+				})
+				watchConnection[env] = true
+			}
 			return cacheConnection[env], nil
 		}
 		return nil, fmt.Errorf("Database driver not supported for %s", env)
@@ -57,13 +77,79 @@ func setConnection(env string) (*Connection, error) {
 	return v, nil
 }
 
-// Open - Open connection with default retry parameter
+// registry - Shared connection pool per env name
+var registry = map[string]*sqlx.DB{}
+var registryMu sync.Mutex
+
+// openMu - Serialize opening per env so dialing one env never blocks another env
+var openMu = map[string]*sync.Mutex{}
+
+// envConnector - Build every new physical connection from current connection string of env,
+// so pool picks up rotated password without being replaced
+type envConnector struct {
+	env string
+}
+
+// Connect - Implement driver.Connector
+func (c *envConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := setConnection(c.env)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := mysql.ParseDSN(conn.DSN)
+	if err != nil {
+		return nil, err
+	}
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+// Driver - Implement driver.Connector
+func (c *envConnector) Driver() driver.Driver {
+	return &mysql.MySQLDriver{}
+}
+
+// cachedConnection -
+func cachedConnection(env string) (*sqlx.DB, bool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	db, ok := registry[env]
+	return db, ok
+}
+
+// Open - Get shared connection pool of env, open with default retry parameter when not yet opened.
+// Returned pool is shared, release it with Close or CloseAll instead of closing it directly
 func Open(env string) (*sqlx.DB, error) {
 	return OpenRetry(env, 3)
 }
 
-// OpenRetry - Open connection with custom retry parameter
+// OpenRetry - Get shared connection pool of env, open with custom retry parameter when not yet opened.
+// New connection of pool always use current password, rotated password is applied without restart
 func OpenRetry(env string, maxRetry int) (*sqlx.DB, error) {
+	if env == "" {
+		env = "db"
+	}
+	if db, ok := cachedConnection(env); ok {
+		return db, nil
+	}
+
+	registryMu.Lock()
+	mu, ok := openMu[env]
+	if !ok {
+		mu = new(sync.Mutex)
+		openMu[env] = mu
+	}
+	registryMu.Unlock()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if db, ok := cachedConnection(env); ok {
+		return db, nil
+	}
+
 	conn, err := setConnection(env)
 	if err != nil {
 		liblogger.Log(nil, true).Errorf("Error set connection string %v", err)
@@ -74,9 +160,74 @@ func OpenRetry(env string, maxRetry int) (*sqlx.DB, error) {
 		maxRetry = 0
 	}
 
-	db, err := sqlx.Connect(conn.Driver, conn.DSN)
+	db := sqlx.NewDb(sql.OpenDB(&envConnector{env: env}), conn.Driver)
+	for attempt := 0; attempt <= maxRetry; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		err = db.Ping()
+		if err == nil {
+			break
+		}
+		liblogger.Log(nil, true).Errorf("Error open connection %s attempt %d %v", env, attempt+1, err)
+	}
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
-	return db, err
+
+	registryMu.Lock()
+	registry[env] = db
+	registryMu.Unlock()
+	return db, nil
+}
+
+// Register - Register pre-built connection pool under env name, e.g. SQLite pool in tests
+func Register(env string, db *sqlx.DB) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[env] = db
+}
+
+// Close - Close and remove connection pool of env
+func Close(env string) error {
+	registryMu.Lock()
+	db, ok := registry[env]
+	delete(registry, env)
+	registryMu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	CloseStatements(db)
+	return db.Close()
+}
+
+// CloseAll - Close every registered connection pool, call on shutdown
+func CloseAll() error {
+	registryMu.Lock()
+	list := registry
+	registry = map[string]*sqlx.DB{}
+	registryMu.Unlock()
+
+	var errClose error
+	for env, db := range list {
+		CloseStatements(db)
+		if err := db.Close(); err != nil {
+			liblogger.Log(nil, true).Errorf("Error close connection %s %v", env, err)
+			errClose = err
+		}
+	}
+	return errClose
+}
+
+// registeredConnection - Snapshot of registered connection pools
+func registeredConnection() map[string]*sqlx.DB {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	list := make(map[string]*sqlx.DB, len(registry))
+	for env, db := range registry {
+		list[env] = db
+	}
+	return list
 }
@@ -0,0 +1,405 @@
+package libdb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/helloferdie/golib/liblogger"
+	"github.com/helloferdie/golib/libsecret"
+)
+
+// cryptPrefix - Prefix of encrypted value, followed by key version and base64 payload
+const cryptPrefix = "enc:v"
+
+// cryptField - Struct field tagged with `crypt:"aes"` or `crypt:"aes,blind=<column>"`
+type cryptField struct {
+	Column string
+	Blind  string
+}
+
+// cryptKeyring - AES keys by version and HMAC key for blind index
+type cryptKeyring struct {
+	current int
+	keys    map[int][]byte
+	blind   []byte
+}
+
+var cryptMu sync.Mutex
+var cryptInitialize = false
+var cryptWatch = false
+var keyring = cryptKeyring{}
+var cryptFieldCache sync.Map
+
+// loadCryptConfig - Load keys from environment
+//   - db_crypt_keys: Secret (see libsecret), comma separated `<version>:<base64 key>`, key must be 16, 24 or 32 bytes
+//   - db_crypt_key_version: Version used to encrypt new value, default to highest version
+//   - db_crypt_blind_key: Secret, base64 HMAC key for blind index, required by blind index and never rotated
+//     with encryption key, otherwise every existing blind index no longer match
+func loadCryptConfig() (cryptKeyring, error) {
+	cryptMu.Lock()
+	defer cryptMu.Unlock()
+	if cryptInitialize {
+		return keyring, nil
+	}
+
+	kr := cryptKeyring{keys: map[int][]byte{}}
+	for _, item := range strings.Split(libsecret.Get("db_crypt_keys"), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		part := strings.SplitN(item, ":", 2)
+		if len(part) != 2 {
+			return kr, errors.New("Error load crypt key: invalid format")
+		}
+		version, err := strconv.Atoi(part[0])
+		if err != nil {
+			return kr, fmt.Errorf("Error load crypt key: invalid version %s", part[0])
+		}
+		key, err := base64.StdEncoding.DecodeString(part[1])
+		if err != nil {
+			return kr, fmt.Errorf("Error load crypt key: invalid key version %d", version)
+		}
+		if _, err := aes.NewCipher(key); err != nil {
+			return kr, fmt.Errorf("Error load crypt key: %v", err)
+		}
+		kr.keys[version] = key
+		if version > kr.current {
+			kr.current = version
+		}
+	}
+	if len(kr.keys) == 0 {
+		return kr, errors.New("Error load crypt key: db_crypt_keys is empty")
+	}
+
+	if v := os.Getenv("db_crypt_key_version"); v != "" {
+		version, err := strconv.Atoi(v)
+		if _, exist := kr.keys[version]; err != nil || !exist {
+			return kr, fmt.Errorf("Error load crypt key: unknown version %s", v)
+		}
+		kr.current = version
+	}
+
+	if v := libsecret.Get("db_crypt_blind_key"); v != "" {
+		key, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return kr, errors.New("Error load crypt key: invalid blind key")
+		}
+		kr.blind = key
+	}
+
+	keyring = kr
+	if !cryptWatch {
+		for _, name := range []string{"db_crypt_keys", "db_crypt_blind_key"} {
+			libsecret.OnChange(name, func(string) {
+				ResetCryptConfig()
+			})
+		}
+		cryptWatch = true
+	}
+	cryptInitialize = true
+	return kr, nil
+}
+
+// ResetCryptConfig - Reload keys from environment on next usage, e.g. after rotating key
+func ResetCryptConfig() {
+	cryptMu.Lock()
+	defer cryptMu.Unlock()
+	cryptInitialize = false
+}
+
+// Encrypt - Encrypt plain text with AES-GCM using current key version
+func Encrypt(plain string) (string, error) {
+	kr, err := loadCryptConfig()
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(kr.keys[kr.current])
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return cryptPrefix + strconv.Itoa(kr.current) + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt - Decrypt value produced by Encrypt, value without encryption prefix is returned as is
+func Decrypt(value string) (string, error) {
+	if !strings.HasPrefix(value, cryptPrefix) {
+		return value, nil
+	}
+	kr, err := loadCryptConfig()
+	if err != nil {
+		return "", err
+	}
+
+	part := strings.SplitN(strings.TrimPrefix(value, cryptPrefix), ":", 2)
+	if len(part) != 2 {
+		return "", errors.New("Error decrypt: invalid format")
+	}
+	version, err := strconv.Atoi(part[0])
+	if err != nil {
+		return "", errors.New("Error decrypt: invalid key version")
+	}
+	key, ok := kr.keys[version]
+	if !ok {
+		return "", fmt.Errorf("Error decrypt: key version %d not found", version)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(part[1])
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("Error decrypt: invalid payload")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// NeedReencrypt - Check whether value is encrypted with key other than current version
+func NeedReencrypt(value string) bool {
+	if !strings.HasPrefix(value, cryptPrefix) {
+		return true
+	}
+	kr, err := loadCryptConfig()
+	if err != nil {
+		return false
+	}
+	return !strings.HasPrefix(value, cryptPrefix+strconv.Itoa(kr.current)+":")
+}
+
+// BlindIndex - Deterministic HMAC of value, used to lookup encrypted column with GetByField
+func BlindIndex(value string) (string, error) {
+	kr, err := loadCryptConfig()
+	if err != nil {
+		return "", err
+	}
+	if len(kr.blind) == 0 {
+		return "", errors.New("Error blind index: db_crypt_blind_key is empty")
+	}
+	mac := hmac.New(sha256.New, kr.blind)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// newGCM -
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// cryptError - Value which fail the query execution when encryption failed
+type cryptError struct {
+	err error
+}
+
+// Value - Implement driver.Valuer
+func (c cryptError) Value() (driver.Value, error) {
+	return nil, c.err
+}
+
+// listCryptField - List crypt tagged fields of struct, cached per type
+func listCryptField(t interface{}) []cryptField {
+	rType := reflect.TypeOf(t)
+	for rType.Kind() == reflect.Ptr {
+		rType = rType.Elem()
+	}
+	if rType.Kind() != reflect.Struct {
+		return nil
+	}
+	if v, ok := cryptFieldCache.Load(rType); ok {
+		return v.([]cryptField)
+	}
+
+	list := appendCryptField(rType, nil)
+	cryptFieldCache.Store(rType, list)
+	return list
+}
+
+// appendCryptField -
+func appendCryptField(rType reflect.Type, list []cryptField) []cryptField {
+	for i := 0; i < rType.NumField(); i++ {
+		field := rType.Field(i)
+		tag := field.Tag.Get("db")
+		if tag == "" {
+			if field.Type.Kind() == reflect.Struct {
+				list = appendCryptField(field.Type, list)
+			}
+			continue
+		}
+
+		crypt := field.Tag.Get("crypt")
+		if crypt == "" {
+			continue
+		}
+		opt := strings.Split(crypt, ",")
+		if opt[0] != "aes" {
+			liblogger.Log(nil, true).Errorf("Error crypt tag: unsupported algorithm %s", opt[0])
+			continue
+		}
+		cf := cryptField{Column: tag}
+		for _, o := range opt[1:] {
+			if strings.HasPrefix(o, "blind=") {
+				cf.Blind = strings.TrimPrefix(o, "blind=")
+			}
+		}
+		list = append(list, cf)
+	}
+	return list
+}
+
+// cryptPlain - Get plain string of supported field value
+func cryptPlain(v interface{}) (string, bool, bool) {
+	switch t := v.(type) {
+	case string:
+		return t, true, true
+	case sql.NullString:
+		return t.String, t.Valid, true
+	case *string:
+		if t == nil {
+			return "", false, true
+		}
+		return *t, true, true
+	}
+	return "", false, false
+}
+
+// sealBlindIndex - Fill blind index column in data map from plain value
+func sealBlindIndex(data interface{}, dataMap map[string]interface{}) {
+	for _, cf := range listCryptField(data) {
+		if cf.Blind == "" {
+			continue
+		}
+		if _, exist := dataMap[cf.Blind]; !exist {
+			continue
+		}
+		plain, valid, ok := cryptPlain(dataMap[cf.Column])
+		if !ok || !valid {
+			dataMap[cf.Blind] = nil
+			continue
+		}
+		idx, err := BlindIndex(plain)
+		if err != nil {
+			dataMap[cf.Blind] = cryptError{err: err}
+			continue
+		}
+		dataMap[cf.Blind] = idx
+	}
+}
+
+// sealMap - Encrypt crypt tagged columns in data map, failed encryption fail the query execution
+func sealMap(data interface{}, dataMap map[string]interface{}) {
+	for _, cf := range listCryptField(data) {
+		v, exist := dataMap[cf.Column]
+		if !exist {
+			continue
+		}
+		plain, valid, ok := cryptPlain(v)
+		if !ok {
+			dataMap[cf.Column] = cryptError{err: fmt.Errorf("Error encrypt: unsupported type %T for %s", v, cf.Column)}
+			continue
+		}
+		if !valid {
+			dataMap[cf.Column] = nil
+			continue
+		}
+		enc, err := Encrypt(plain)
+		if err != nil {
+			dataMap[cf.Column] = cryptError{err: err}
+			continue
+		}
+		dataMap[cf.Column] = enc
+	}
+}
+
+// DecryptStruct - Decrypt crypt tagged fields of struct pointer or slice in place, called after scan
+func DecryptStruct(dt interface{}) error {
+	rVal := reflect.ValueOf(dt)
+	for rVal.Kind() == reflect.Ptr {
+		if rVal.IsNil() {
+			return nil
+		}
+		rVal = rVal.Elem()
+	}
+
+	if rVal.Kind() == reflect.Slice {
+		if len(listCryptField(reflect.New(rVal.Type().Elem()).Interface())) == 0 {
+			return nil
+		}
+		for i := 0; i < rVal.Len(); i++ {
+			row := rVal.Index(i)
+			if row.Kind() != reflect.Ptr {
+				row = row.Addr()
+			}
+			if err := DecryptStruct(row.Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if rVal.Kind() != reflect.Struct {
+		return nil
+	}
+	for _, cf := range listCryptField(rVal.Interface()) {
+		field, ok := fieldByTagDB(rVal, cf.Column)
+		if !ok || !field.CanSet() {
+			continue
+		}
+
+		switch v := field.Addr().Interface().(type) {
+		case *string:
+			plain, err := Decrypt(*v)
+			if err != nil {
+				return err
+			}
+			*v = plain
+		case *sql.NullString:
+			if v.Valid {
+				plain, err := Decrypt(v.String)
+				if err != nil {
+					return err
+				}
+				v.String = plain
+			}
+		case **string:
+			if *v != nil {
+				plain, err := Decrypt(**v)
+				if err != nil {
+					return err
+				}
+				*v = &plain
+			}
+		}
+	}
+	return nil
+}
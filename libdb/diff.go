@@ -0,0 +1,238 @@
+package libdb
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/helloferdie/golib/libslice"
+)
+
+// DiffMask - Replacement value for sensitive column in diff result
+const DiffMask = "******"
+
+// DiffValue - Old and new value of changed column
+//   - Redact: Action of `audit` struct tag of column, applied to audit payload by Redactor.Diff
+type DiffValue struct {
+	Old    interface{} `json:"o"`
+	New    interface{} `json:"n"`
+	Redact string      `json:"-"`
+}
+
+// Diff - Changed columns between old and new data, keyed by column name
+type Diff map[string]DiffValue
+
+// Columns - List changed columns in sorted order
+func (df Diff) Columns() []string {
+	col := make([]string, 0, len(df))
+	for k := range df {
+		col = append(col, k)
+	}
+	sort.Strings(col)
+	return col
+}
+
+// Map - Convert to generic map, same format as stored in audit trail change
+func (df Diff) Map() map[string]interface{} {
+	m := make(map[string]interface{}, len(df))
+	for k, v := range df {
+		m[k] = map[string]interface{}{
+			"o": v.Old,
+			"n": v.New,
+		}
+	}
+	return m
+}
+
+// WithRedactTag - Carry `audit` struct tag actions of struct on changed columns, see RedactTag
+func (df Diff) WithRedactTag(t interface{}) Diff {
+	tags := RedactTag(t)
+	for k, v := range df {
+		if action, ok := tags[k]; ok {
+			v.Redact = action
+			df[k] = v
+		}
+	}
+	return df
+}
+
+// Comparator - Return true when both values are considered equal
+type Comparator func(old interface{}, new interface{}) bool
+
+// Differ - Compare old and new data to produce diff
+//   - Ignore: Columns never compared and never updated
+//   - Sensitive: Columns updated as usual but masked in diff result
+//   - TimePrecision: Precision used to compare time values, default to microsecond
+//   - Columns: Comparator per column, e.g. CompareDecimal or CompareJSON
+//   - Types: Comparator per Go type, applied when no column comparator registered
+type Differ struct {
+	Ignore        []string
+	Sensitive     []string
+	TimePrecision time.Duration
+	Columns       map[string]Comparator
+	Types         map[reflect.Type]Comparator
+}
+
+// DefaultDiffer -
+var DefaultDiffer = &Differ{}
+
+// differ - Get configured differ
+func (cfg *Config) differ() *Differ {
+	if cfg.Differ != nil {
+		return cfg.Differ
+	}
+	return DefaultDiffer
+}
+
+// Compare - Compare old and new values for given columns, column missing from newMap is skipped
+func (d *Differ) Compare(columns []string, oldMap map[string]interface{}, newMap map[string]interface{}) Diff {
+	df := Diff{}
+	for _, col := range columns {
+		if _, ignore := libslice.Contains(col, d.Ignore); ignore {
+			continue
+		}
+
+		newVal, ok := newMap[col]
+		if !ok {
+			continue
+		}
+		oldVal := oldMap[col]
+		if d.Equal(col, oldVal, newVal) {
+			continue
+		}
+
+		if _, sensitive := libslice.Contains(col, d.Sensitive); sensitive {
+			df[col] = DiffValue{Old: DiffMask, New: DiffMask}
+			continue
+		}
+		df[col] = DiffValue{Old: oldVal, New: newVal}
+	}
+	return df
+}
+
+// CompareStruct - Compare db tagged fields of old and new struct for given columns, diff carries `audit` struct tag actions of new
+func (d *Differ) CompareStruct(columns []string, old interface{}, new interface{}) Diff {
+	df := d.Compare(columns, MapTagDB(old, map[string]interface{}{}), MapTagDB(new, map[string]interface{}{}))
+	return df.WithRedactTag(new)
+}
+
+// Equal - Compare single column value
+func (d *Differ) Equal(column string, old interface{}, new interface{}) bool {
+	if cmp, ok := d.Columns[column]; ok {
+		return cmp(old, new)
+	}
+	if old != nil {
+		if cmp, ok := d.Types[reflect.TypeOf(old)]; ok {
+			return cmp(old, new)
+		}
+	}
+
+	precision := d.TimePrecision
+	if precision <= 0 {
+		precision = time.Microsecond
+	}
+	oldTime, oldIsTime := toTime(old)
+	newTime, newIsTime := toTime(new)
+	if oldIsTime || newIsTime {
+		if oldTime == nil || newTime == nil {
+			return oldTime == nil && newTime == nil
+		}
+		return oldTime.Truncate(precision).Equal(newTime.Truncate(precision))
+	}
+
+	if ob, ok := old.([]byte); ok {
+		nb, ok := new.([]byte)
+		return ok && bytes.Equal(ob, nb)
+	}
+	return reflect.DeepEqual(old, new)
+}
+
+// toTime - Unwrap time value, return nil time for invalid sql.NullTime or nil pointer
+func toTime(v interface{}) (*time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return &t, true
+	case *time.Time:
+		return t, true
+	case sql.NullTime:
+		if !t.Valid {
+			return nil, true
+		}
+		return &t.Time, true
+	}
+	return nil, false
+}
+
+// CompareDecimal - Compare numeric values by exact decimal value, e.g. "10.50" equal to "10.5"
+func CompareDecimal(old interface{}, new interface{}) bool {
+	o, okOld := toRat(old)
+	n, okNew := toRat(new)
+	if !okOld || !okNew {
+		return reflect.DeepEqual(old, new)
+	}
+	return o.Cmp(n) == 0
+}
+
+// toRat - Convert numeric or numeric string to big.Rat
+func toRat(v interface{}) (*big.Rat, bool) {
+	if valuer, ok := v.(driver.Valuer); ok {
+		dv, err := valuer.Value()
+		if err != nil {
+			return nil, false
+		}
+		v = dv
+	}
+
+	r := new(big.Rat)
+	switch t := v.(type) {
+	case string:
+		return r.SetString(t)
+	case []byte:
+		return r.SetString(string(t))
+	case float32, float64, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return r.SetString(fmt.Sprint(t))
+	}
+	return nil, false
+}
+
+// CompareJSON - Compare JSON column semantically, ignoring key order and whitespace
+func CompareJSON(old interface{}, new interface{}) bool {
+	o, okOld := toJSON(old)
+	n, okNew := toJSON(new)
+	if !okOld || !okNew {
+		return reflect.DeepEqual(old, new)
+	}
+	return reflect.DeepEqual(o, n)
+}
+
+// toJSON - Decode JSON string or bytes into generic value
+func toJSON(v interface{}) (interface{}, bool) {
+	var raw []byte
+	switch t := v.(type) {
+	case string:
+		raw = []byte(t)
+	case []byte:
+		raw = t
+	case json.RawMessage:
+		raw = t
+	case sql.NullString:
+		if !t.Valid {
+			return nil, true
+		}
+		raw = []byte(t.String)
+	default:
+		return nil, false
+	}
+
+	var out interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, false
+	}
+	return out, true
+}
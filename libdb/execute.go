@@ -3,7 +3,6 @@ package libdb
 import (
 	"errors"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
@@ -52,6 +51,11 @@ func Get(d *sqlx.DB, list interface{}, query string, values map[string]interface
 			liblogger.Log(nil, true).Errorf("Error scan row %v", err)
 			return exist, err
 		}
+		err = DecryptStruct(list)
+		if err != nil {
+			liblogger.Log(nil, true).Errorf("Error decrypt row %v", err)
+			return exist, err
+		}
 		exist = true
 	}
 	rows.Close()
@@ -90,16 +94,22 @@ func GetSoftDeleteByID(d *sqlx.DB, cfg Config, dt interface{}, id int64) (bool,
 
 // Select - Select rows from query
 func Select(d *sqlx.DB, list interface{}, query string, values map[string]interface{}) error {
-	nstmt, err := d.PrepareNamed(query)
+	nstmt, release, err := PrepareNamed(d, query)
 	if err != nil {
 		liblogger.Log(nil, true).Errorf("Error select prepare named query %v", err)
 		return err
 	}
+	defer release()
 	err = nstmt.Select(list, values)
 	if err != nil {
 		liblogger.Log(nil, true).Errorf("Error select query %v", err)
 		return err
 	}
+	err = DecryptStruct(list)
+	if err != nil {
+		liblogger.Log(nil, true).Errorf("Error decrypt rows %v", err)
+		return err
+	}
 	return nil
 }
 
@@ -122,82 +132,139 @@ func ListByField(d *sqlx.DB, list interface{}, conditionVal map[string]interface
 		conditionVal[k] = v
 	}
 
-	nstmt, err := d.PrepareNamed("SELECT " + fields + " FROM " + table + " WHERE 1=1 " + condition + orderQuery)
+	nstmt, release, err := PrepareNamed(d, "SELECT "+fields+" FROM "+table+" WHERE 1=1 "+condition+orderQuery)
 	if err != nil {
 		liblogger.Log(nil, true).Errorf("Error select prepare named query %v", err)
 		return t.Total, err
 	}
+	defer release()
 
 	err = nstmt.Select(list, conditionVal)
 	if err != nil {
 		liblogger.Log(nil, true).Errorf("Error select query %v", err)
 		return t.Total, err
 	}
+	err = DecryptStruct(list)
+	if err != nil {
+		liblogger.Log(nil, true).Errorf("Error decrypt rows %v", err)
+		return t.Total, err
+	}
 	return t.Total, nil
 }
 
 // ListRaw - Raw query list
 func ListRaw(d *sqlx.DB, list interface{}, query string, conditionVal map[string]interface{}) error {
-	nstmt, err := d.PrepareNamed(query)
+	nstmt, release, err := PrepareNamed(d, query)
 	if err != nil {
 		liblogger.Log(nil, true).Errorf("Error select prepare named query %v", err)
 		return err
 	}
+	defer release()
 
 	err = nstmt.Select(list, conditionVal)
 	if err != nil {
 		liblogger.Log(nil, true).Errorf("Error select query %v", err)
 		return err
 	}
+	err = DecryptStruct(list)
+	if err != nil {
+		liblogger.Log(nil, true).Errorf("Error decrypt rows %v", err)
+		return err
+	}
 	return nil
 }
 
-// ValidateList -
+// ValidateList - Check every value of []int64 or []string exists in column
 func ValidateList(d *sqlx.DB, table string, column string, condition string, list interface{}) (bool, error) {
-	values := map[string]interface{}{}
-	queryValues := []string{}
-
-	var total int64 = 0
-	listInt64, ok := list.([]int64)
-	if ok {
-		for k, v := range listInt64 {
-			col := "val_" + strconv.Itoa(k)
-			values[col] = v
-			queryValues = append(queryValues, ":"+col)
+	cfg := Config{Table: table}
+	var missing int
+	var err error
+	switch v := list.(type) {
+	case []int64:
+		var m []int64
+		m, err = ValidateExist(d, cfg, column, condition, nil, v)
+		missing = len(m)
+	case []string:
+		var m []string
+		m, err = ValidateExist(d, cfg, column, condition, nil, v)
+		missing = len(m)
+	default:
+		err = errors.New("Error validate list: interface type not supported")
+		liblogger.Log(nil, true).Error(err)
+	}
+	return err == nil && missing == 0, err
+}
+
+// ValidateChunkSize - Maximum values per IN clause used by ValidateExist
+var ValidateChunkSize = 500
+
+// ValidateExist - Return values of list not found in column, duplicates are ignored and soft deleted rows are treated as missing.
+// On MySQL string is compared case-insensitively to follow default `_ci` collation, column with case-sensitive collation
+// may report differently cased value as found
+func ValidateExist[T int64 | string](d *sqlx.DB, cfg Config, column string, condition string, conditionVal map[string]interface{}, list []T) ([]T, error) {
+	chunk := ValidateChunkSize
+	if chunk < 1 {
+		chunk = 1
+	}
+	fold := d.DriverName() == "mysql"
+	normalize := func(v T) T {
+		if s, ok := any(v).(string); ok && fold {
+			return any(strings.ToLower(s)).(T)
 		}
-		total = int64(len(listInt64))
-	} else {
-		listString, ok := list.([]string)
-		if ok {
-			for k, v := range listString {
-				col := "val_" + strconv.Itoa(k)
-				values[col] = v
-				queryValues = append(queryValues, ":"+col)
-			}
-			total = int64(len(listString))
-		} else {
-			err := errors.New("Error validate list: interface type not supported")
-			liblogger.Log(nil, true).Error(err)
-			return false, err
+		return v
+	}
+
+	unique := make([]T, 0, len(list))
+	seen := make(map[T]bool, len(list))
+	for _, v := range list {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
 		}
 	}
 
-	t := new(ModelTotal)
-	_, err := Get(d, t, "SELECT COUNT("+column+") AS total FROM "+table+" WHERE "+column+" IN ("+strings.Join(queryValues, ", ")+") "+condition, values)
-	if err != nil {
-		return false, err
+	found := make(map[T]bool, len(unique))
+	for start := 0; start < len(unique); start += chunk {
+		end := start + chunk
+		if end > len(unique) {
+			end = len(unique)
+		}
+
+		values := map[string]interface{}{}
+		for k, v := range conditionVal {
+			values[k] = v
+		}
+		in := PrepareInQuery("AND "+column+" IN", "validate", unique[start:end], values)
+
+		exist := []T{}
+		err := Select(d, &exist, "SELECT DISTINCT "+column+" FROM "+cfg.Table+" WHERE 1=1 "+in+" "+cfg.GetConditionSoftDelete()+condition, values)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range exist {
+			found[normalize(v)] = true
+		}
 	}
 
-	if t.Total == total {
-		return true, err
+	missing := []T{}
+	for _, v := range unique {
+		if !found[normalize(v)] {
+			missing = append(missing, v)
+		}
 	}
-	return false, err
+	return missing, nil
 }
 
 // Create - Create from query
 func Create(d *sqlx.DB, cfg Config, dt interface{}, mode Mode, returnData bool) error {
+	err := cfg.AssignID(dt)
+	if err != nil {
+		liblogger.Log(nil, true).Errorf("Error assign ID %v", err)
+		return err
+	}
+
 	driver := d.DriverName()
-	query, val := PrepareInsert(cfg.Table, dt, mode)
+	query, val := PrepareInsert(cfg.Table, dt, cfg.insertMode(mode))
 	if driver == "postgres" {
 		if returnData {
 			query += " RETURNING *"
@@ -212,8 +279,28 @@ func Create(d *sqlx.DB, cfg Config, dt interface{}, mode Mode, returnData bool)
 	return err
 }
 
+// CreateBulk - Create multiple rows from single query
+func CreateBulk(d *sqlx.DB, cfg Config, list interface{}, mode Mode) error {
+	err := cfg.assignIDList(list)
+	if err != nil {
+		liblogger.Log(nil, true).Errorf("Error assign ID %v", err)
+		return err
+	}
+
+	query, val, err := PrepareInsertBulk(cfg.Table, list, cfg.insertMode(mode))
+	if err != nil {
+		liblogger.Log(nil, true).Error(err)
+		return err
+	}
+	_, err = d.NamedExec(query, val)
+	if err != nil {
+		liblogger.Log(nil, true).Errorf("Error execute query %v", err)
+	}
+	return err
+}
+
 // Update - General update from query
-func Update(d *sqlx.DB, cfg Config, old interface{}, new interface{}, mode Mode, pk interface{}, returnData bool) (map[string]interface{}, error) {
+func Update(d *sqlx.DB, cfg Config, old interface{}, new interface{}, mode Mode, pk interface{}, returnData bool) (Diff, error) {
 	diff, err := UpdateCustom(d, cfg, old, new, mode, "AND id = :id ", map[string]interface{}{
 		"id": pk,
 	}, returnData)
@@ -221,9 +308,19 @@ func Update(d *sqlx.DB, cfg Config, old interface{}, new interface{}, mode Mode,
 }
 
 // UpdateCustom - Custome update from query
-func UpdateCustom(d *sqlx.DB, cfg Config, old interface{}, new interface{}, mode Mode, condition string, conditionVal map[string]interface{}, returnData bool) (map[string]interface{}, error) {
+func UpdateCustom(d *sqlx.DB, cfg Config, old interface{}, new interface{}, mode Mode, condition string, conditionVal map[string]interface{}, returnData bool) (Diff, error) {
+	if cfg.History {
+		var diff Diff
+		err := runTx(d, func(tx *sqlx.Tx) error {
+			var err error
+			diff, err = TxUpdateCustom(tx, cfg, old, new, mode, condition, conditionVal, returnData)
+			return err
+		})
+		return diff, err
+	}
+
 	driver := d.DriverName()
-	query, val, diff := PrepareUpdate(cfg.Table, old, new, condition, conditionVal, mode)
+	query, val, diff := PrepareUpdateDiff(cfg.Table, old, new, condition, conditionVal, mode, cfg.differ())
 	if driver == "postgres" {
 		if returnData {
 			query += " RETURNING *"
@@ -253,6 +350,12 @@ func HardDelete(d *sqlx.DB, cfg Config, pk interface{}) error {
 
 // HardDeleteCustom - Custom hard delete from query
 func HardDeleteCustom(d *sqlx.DB, cfg Config, condition string, conditionVal map[string]interface{}) error {
+	if cfg.History {
+		return runTx(d, func(tx *sqlx.Tx) error {
+			return TxDeleteCustom(tx, cfg, condition, conditionVal)
+		})
+	}
+
 	query := "DELETE FROM " + cfg.Table + " WHERE 1=1 " + condition
 	_, err := d.NamedExec(query, conditionVal)
 	return err
@@ -274,6 +377,12 @@ func UnsoftDelete(d *sqlx.DB, cfg Config, pk interface{}) error {
 
 // SoftDeleteCustom - Custom soft delete from query
 func SoftDeleteCustom(d *sqlx.DB, cfg Config, condition string, conditionVal map[string]interface{}, revoke bool) error {
+	if cfg.History {
+		return runTx(d, func(tx *sqlx.Tx) error {
+			return TxSoftDeleteCustom(tx, cfg, condition, conditionVal, revoke)
+		})
+	}
+
 	delQuery := "deleted_at = "
 	if revoke {
 		delQuery += "NULL"
@@ -289,6 +398,8 @@ func SoftDeleteCustom(d *sqlx.DB, cfg Config, condition string, conditionVal map
 }
 
 // GenerateUUID - Generate unique UUID
+//
+// Deprecated: Set Config.IDColumn and Config.IDGenerator to let Create assign the ID, and rely on unique index instead of lookup
 func GenerateUUID(d *sqlx.DB, cfg Config, dt interface{}) (string, error) {
 	appMode := os.Getenv("app_mode")
 	if appMode == "production" {
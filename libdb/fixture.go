@@ -0,0 +1,250 @@
+package libdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/helloferdie/golib/liblogger"
+	"github.com/helloferdie/golib/libslice"
+
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/yaml.v3"
+)
+
+// fixtureRefPrefix - Reference to other fixture row, `$ref:<table>.<label>` or `$ref:<table>.<label>.<column>`
+const fixtureRefPrefix = "$ref:"
+
+// Fixture - Fixture rows keyed by table name then by row label
+type Fixture map[string]map[string]map[string]interface{}
+
+// FixtureLoader - Load fixture into database
+//   - Mode: Insert mode, default to DefaultMode. Explicit `id` in fixture row is always inserted
+//   - Truncate: Delete existing rows of fixture tables before loading, in reverse dependency order
+type FixtureLoader struct {
+	Mode     Mode
+	Truncate bool
+}
+
+// ReadFixture - Read fixture from YAML (.yml, .yaml) or JSON (.json) files, later files are merged into earlier ones
+func ReadFixture(paths ...string) (Fixture, error) {
+	fx := Fixture{}
+	for _, path := range paths {
+		bt, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		tmp := Fixture{}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yml", ".yaml":
+			err = yaml.Unmarshal(bt, &tmp)
+		case ".json":
+			err = json.Unmarshal(bt, &tmp)
+		default:
+			err = fmt.Errorf("Error read fixture: unsupported file %s", path)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for table, rows := range tmp {
+			if fx[table] == nil {
+				fx[table] = map[string]map[string]interface{}{}
+			}
+			for label, row := range rows {
+				fx[table][label] = row
+			}
+		}
+	}
+	return fx, nil
+}
+
+// LoadFixture - Read fixture files and load them with default loader
+func LoadFixture(d *sqlx.DB, paths ...string) error {
+	fx, err := ReadFixture(paths...)
+	if err != nil {
+		liblogger.Log(nil, true).Errorf("Error read fixture %v", err)
+		return err
+	}
+	l := FixtureLoader{Mode: DefaultMode, Truncate: true}
+	return l.Load(d, fx)
+}
+
+// Load - Load fixture within single transaction
+func (l *FixtureLoader) Load(d *sqlx.DB, fx Fixture) error {
+	order, err := fx.tableOrder()
+	if err != nil {
+		liblogger.Log(nil, true).Error(err)
+		return err
+	}
+
+	tx, err := TxBegin(d)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if l.Truncate {
+		// DELETE instead of TRUNCATE, MySQL refuse to truncate table referenced by foreign key
+		for i := len(order) - 1; i >= 0; i-- {
+			_, err = tx.Exec("DELETE FROM " + order[i])
+			if err != nil {
+				liblogger.Log(nil, true).Errorf("Error truncate fixture table %s %v", order[i], err)
+				return err
+			}
+		}
+	}
+
+	inserted := map[string]map[string]interface{}{}
+	for _, table := range order {
+		labels := make([]string, 0, len(fx[table]))
+		for label := range fx[table] {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+
+		for _, label := range labels {
+			row, err := resolveFixtureRow(fx[table][label], inserted)
+			if err != nil {
+				liblogger.Log(nil, true).Errorf("Error resolve fixture %s.%s %v", table, label, err)
+				return err
+			}
+
+			id, err := l.insert(tx, table, row)
+			if err != nil {
+				liblogger.Log(nil, true).Errorf("Error insert fixture %s.%s %v", table, label, err)
+				return err
+			}
+			row["id"] = id
+			inserted[table+"."+label] = row
+		}
+	}
+	return tx.Commit()
+}
+
+// insert - Insert single fixture row, return its id
+func (l *FixtureLoader) insert(tx *sqlx.Tx, table string, row map[string]interface{}) (interface{}, error) {
+	col, val := prepareInsertColumn(row, l.Mode)
+	id, hasID := row["id"]
+	if _, exist := libslice.Contains("id", col); hasID && !exist {
+		col = append([]string{"id"}, col...)
+		val["id"] = id
+	}
+
+	named := make([]string, 0, len(col))
+	for _, c := range col {
+		named = append(named, ":"+c)
+	}
+	query := "INSERT INTO " + table + " (" + quoteColumn(col) + ") VALUES (" + strings.Join(named, ", ") + ")"
+
+	if tx.DriverName() == "postgres" {
+		query = strings.ReplaceAll(query, "`", "\"")
+		if hasID {
+			_, err := tx.NamedExec(query, val)
+			return id, err
+		}
+		m := new(returningID)
+		_, err := TxGet(tx, m, query+" RETURNING id", val)
+		return m.ID, err
+	}
+
+	lastID, _, err := TxExec(tx, query, val)
+	if hasID {
+		return id, err
+	}
+	return lastID, err
+}
+
+// tableOrder - Sort tables so referenced tables are loaded first
+func (fx Fixture) tableOrder() ([]string, error) {
+	deps := map[string][]string{}
+	tables := make([]string, 0, len(fx))
+	for table, rows := range fx {
+		tables = append(tables, table)
+		for _, row := range rows {
+			for _, v := range row {
+				s, ok := v.(string)
+				if !ok || !strings.HasPrefix(s, fixtureRefPrefix) {
+					continue
+				}
+				ref := strings.SplitN(strings.TrimPrefix(s, fixtureRefPrefix), ".", 2)[0]
+				if _, exist := fx[ref]; !exist {
+					return nil, fmt.Errorf("Error fixture: table %s referenced by %s not found", ref, table)
+				}
+				if ref != table {
+					deps[table] = append(deps[table], ref)
+				}
+			}
+		}
+	}
+	sort.Strings(tables)
+
+	order := []string{}
+	state := map[string]int{} // 1 visiting, 2 done
+	var visit func(table string) error
+	visit = func(table string) error {
+		switch state[table] {
+		case 1:
+			return fmt.Errorf("Error fixture: circular reference on table %s", table)
+		case 2:
+			return nil
+		}
+		state[table] = 1
+		dep := libslice.Unique(deps[table])
+		sort.Strings(dep)
+		for _, ref := range dep {
+			if err := visit(ref); err != nil {
+				return err
+			}
+		}
+		state[table] = 2
+		order = append(order, table)
+		return nil
+	}
+	for _, table := range tables {
+		if err := visit(table); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// resolveFixtureRow - Replace reference with inserted value, encode nested value as JSON
+func resolveFixtureRow(row map[string]interface{}, inserted map[string]map[string]interface{}) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(row))
+	for k, v := range row {
+		switch t := v.(type) {
+		case string:
+			if !strings.HasPrefix(t, fixtureRefPrefix) {
+				out[k] = t
+				continue
+			}
+			part := strings.Split(strings.TrimPrefix(t, fixtureRefPrefix), ".")
+			if len(part) < 2 || len(part) > 3 {
+				return nil, fmt.Errorf("invalid reference %s", t)
+			}
+			target, ok := inserted[part[0]+"."+part[1]]
+			if !ok {
+				return nil, fmt.Errorf("reference %s not loaded", t)
+			}
+			column := "id"
+			if len(part) == 3 {
+				column = part[2]
+			}
+			out[k] = target[column]
+		case map[string]interface{}, []interface{}:
+			bt, err := json.Marshal(t)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = string(bt)
+		default:
+			out[k] = t
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,207 @@
+package libdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PoolStats - Connection pool statistics
+type PoolStats struct {
+	MaxOpen      int     `json:"max_open"`
+	Open         int     `json:"open"`
+	InUse        int     `json:"in_use"`
+	Idle         int     `json:"idle"`
+	WaitCount    int64   `json:"wait_count"`
+	WaitDuration float64 `json:"wait_duration_ms"`
+}
+
+// HealthStatus - Health report of connection registered by env name
+type HealthStatus struct {
+	Env            string    `json:"env"`
+	Healthy        bool      `json:"healthy"`
+	Error          string    `json:"error,omitempty"`
+	Latency        float64   `json:"latency_ms"`
+	Stats          PoolStats `json:"stats"`
+	Replica        bool      `json:"replica"`
+	ReplicationLag *float64  `json:"replication_lag_seconds,omitempty"`
+	CheckedAt      time.Time `json:"checked_at"`
+}
+
+var healthMu sync.Mutex
+var healthCache []HealthStatus
+var healthCheckedAt time.Time
+
+// healthCacheDuration - Load cache duration from `db_health_cache_seconds`, default to 2 seconds
+func healthCacheDuration() time.Duration {
+	v, err := strconv.Atoi(os.Getenv("db_health_cache_seconds"))
+	if err != nil || v < 0 {
+		v = 2
+	}
+	return time.Duration(v) * time.Second
+}
+
+// Health - Check every registered connection, result cached briefly to protect database from probe storm
+func Health(ctx context.Context, timeout time.Duration) []HealthStatus {
+	healthMu.Lock()
+	if healthCache != nil && time.Since(healthCheckedAt) < healthCacheDuration() {
+		result := healthCache
+		healthMu.Unlock()
+		return result
+	}
+	healthMu.Unlock()
+
+	conns := registeredConnection()
+	envs := make([]string, 0, len(conns))
+	for env := range conns {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+
+	result := make([]HealthStatus, len(envs))
+	var wg sync.WaitGroup
+	for k, env := range envs {
+		wg.Add(1)
+		go func(k int, env string) {
+			defer wg.Done()
+			result[k] = CheckHealth(ctx, env, conns[env], timeout)
+		}(k, env)
+	}
+	wg.Wait()
+
+	healthMu.Lock()
+	healthCache = result
+	healthCheckedAt = time.Now()
+	healthMu.Unlock()
+	return result
+}
+
+// CheckHealth - Ping connection and report pool statistics, replication lag reported when `<env>_replica` is 1
+func CheckHealth(ctx context.Context, env string, d *sqlx.DB, timeout time.Duration) HealthStatus {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	h := HealthStatus{
+		Env:       env,
+		Stats:     poolStats(d.Stats()),
+		Replica:   os.Getenv(env+"_replica") == "1",
+		CheckedAt: time.Now().UTC(),
+	}
+
+	start := time.Now()
+	err := d.PingContext(ctx)
+	h.Latency = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		h.Error = err.Error()
+		return h
+	}
+
+	if h.Replica {
+		lag, err := replicationLag(ctx, d)
+		if err != nil {
+			h.Error = err.Error()
+			return h
+		}
+		h.ReplicationLag = lag
+	}
+	h.Healthy = true
+	return h
+}
+
+// poolStats -
+func poolStats(s sql.DBStats) PoolStats {
+	return PoolStats{
+		MaxOpen:      s.MaxOpenConnections,
+		Open:         s.OpenConnections,
+		InUse:        s.InUse,
+		Idle:         s.Idle,
+		WaitCount:    s.WaitCount,
+		WaitDuration: float64(s.WaitDuration.Microseconds()) / 1000,
+	}
+}
+
+// ErrReplicationStopped - Replica is not replicating, reported as unhealthy
+var ErrReplicationStopped = errors.New("Error replication: replica is not replicating")
+
+// replicationLag - Get replication lag in seconds, error when replication is not configured or stopped.
+// Postgres replica which has not replayed any transaction yet report nil lag
+func replicationLag(ctx context.Context, d *sqlx.DB) (*float64, error) {
+	if d.DriverName() == "postgres" {
+		var recovery bool
+		var lag sql.NullFloat64
+		err := d.QueryRowxContext(ctx, "SELECT pg_is_in_recovery(), EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())").Scan(&recovery, &lag)
+		if err != nil {
+			return nil, err
+		}
+		if !recovery {
+			return nil, ErrReplicationStopped
+		}
+		if !lag.Valid {
+			return nil, nil
+		}
+		return &lag.Float64, nil
+	}
+
+	// MySQL 8.0.22 rename slave to replica, fallback for older version
+	rows, err := d.QueryxContext(ctx, "SHOW REPLICA STATUS")
+	if err != nil {
+		rows, err = d.QueryxContext(ctx, "SHOW SLAVE STATUS")
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrReplicationStopped
+	}
+	m := map[string]interface{}{}
+	if err := rows.MapScan(m); err != nil {
+		return nil, err
+	}
+	for k, v := range m {
+		if k != "Seconds_Behind_Source" && k != "Seconds_Behind_Master" {
+			continue
+		}
+		// NULL when replication thread stopped
+		var s string
+		switch t := v.(type) {
+		case []byte:
+			s = string(t)
+		case string:
+			s = t
+		case int64:
+			s = strconv.FormatInt(t, 10)
+		}
+		lag, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, ErrReplicationStopped
+		}
+		return &lag, nil
+	}
+	return nil, ErrReplicationStopped
+}
+
+// ReadinessCheck - Readiness check of every registered connection, compatible with libecho.Readiness
+func ReadinessCheck(timeout time.Duration) func(ctx context.Context) (bool, interface{}) {
+	return func(ctx context.Context) (bool, interface{}) {
+		result := Health(ctx, timeout)
+		for _, h := range result {
+			if !h.Healthy {
+				return false, result
+			}
+		}
+		return true, result
+	}
+}
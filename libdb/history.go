@@ -0,0 +1,83 @@
+package libdb
+
+import (
+	"time"
+
+	"github.com/helloferdie/golib/liblogger"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// History table `<table>_history` must contain every column of Config.Fields plus
+// `valid_from`, `valid_to` and `history_operation`, prior version of row is copied
+// into it before update, soft delete, unsoft delete and hard delete.
+
+// HistoryTable - Get history table name
+func (cfg *Config) HistoryTable() string {
+	return cfg.Table + "_history"
+}
+
+// txHistory - Copy current version of matching rows into history table
+func txHistory(tx *sqlx.Tx, cfg Config, condition string, conditionVal map[string]interface{}, operation string) error {
+	if !cfg.History {
+		return nil
+	}
+
+	values := map[string]interface{}{}
+	for k, v := range conditionVal {
+		values[k] = v
+	}
+	values["history_valid_to"] = time.Now().UTC()
+	values["history_operation"] = operation
+
+	query := "INSERT INTO " + cfg.HistoryTable() + " (" + cfg.Fields + ", valid_from, valid_to, history_operation) " +
+		"SELECT " + cfg.Fields + ", COALESCE(updated_at, created_at), :history_valid_to, :history_operation FROM " + cfg.Table + " WHERE 1=1 " + condition
+	_, err := tx.NamedExec(query, values)
+	if err != nil {
+		liblogger.Log(nil, true).Errorf("Error copy history %v", err)
+	}
+	return err
+}
+
+// runTx - Run fn within new transaction, commit when fn succeed
+func runTx(d *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	tx, err := TxBegin(d)
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetAsOf - Get version of row by ID as it was at given time, return false when row did not exist or was deleted
+func GetAsOf(d *sqlx.DB, cfg Config, dt interface{}, pk interface{}, at time.Time) (bool, error) {
+	values := map[string]interface{}{
+		"id": pk,
+		"at": at.UTC(),
+	}
+
+	exist, err := Get(d, dt, "SELECT "+cfg.Fields+" FROM "+cfg.HistoryTable()+" WHERE id = :id AND valid_from <= :at AND valid_to > :at "+
+		"ORDER BY valid_to ASC LIMIT 1", values)
+	if err != nil || exist {
+		return exist, err
+	}
+
+	condition := ""
+	if cfg.SoftDelete {
+		condition = "AND (deleted_at IS NULL OR deleted_at > :at) "
+	}
+	return Get(d, dt, "SELECT "+cfg.Fields+" FROM "+cfg.Table+" WHERE id = :id AND COALESCE(updated_at, created_at) <= :at "+condition, values)
+}
+
+// ListHistory - List prior versions of row by ID ordered from oldest, list element should embed ModelHistory
+func ListHistory(d *sqlx.DB, cfg Config, list interface{}, pk interface{}) error {
+	return Select(d, list, "SELECT "+cfg.Fields+", valid_from, valid_to, history_operation FROM "+cfg.HistoryTable()+
+		" WHERE id = :id ORDER BY valid_to ASC", map[string]interface{}{
+		"id": pk,
+	})
+}
@@ -0,0 +1,134 @@
+package libdb
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/helloferdie/golib/libid"
+)
+
+// generator - Get configured ID generator
+func (cfg *Config) generator() libid.Generator {
+	if cfg.IDGenerator != nil {
+		return cfg.IDGenerator
+	}
+	return libid.UUIDv4
+}
+
+// AssignID - Assign generated ID to the field tagged with IDColumn if it is still empty
+func (cfg *Config) AssignID(dt interface{}) error {
+	if cfg.IDColumn == "" {
+		return nil
+	}
+
+	rVal := reflect.ValueOf(dt)
+	if rVal.Kind() != reflect.Ptr || rVal.IsNil() {
+		return fmt.Errorf("Error assign ID: %T is not a pointer", dt)
+	}
+
+	field, ok := fieldByTagDB(rVal.Elem(), cfg.IDColumn)
+	if !ok {
+		return fmt.Errorf("Error assign ID: column %s not found in %T", cfg.IDColumn, dt)
+	}
+	if !field.IsZero() {
+		return nil
+	}
+
+	id, err := cfg.generator().Generate()
+	if err != nil {
+		return err
+	}
+	return setFieldString(field, id)
+}
+
+// insertMode - Keep IDColumn in insert columns regardless of mode, otherwise ID assigned by AssignID is
+// never stored, e.g. `id` is skipped by default mode
+func (cfg *Config) insertMode(mode Mode) Mode {
+	if cfg.IDColumn == "" {
+		return mode
+	}
+	mode.keep = append(append([]string{}, mode.keep...), cfg.IDColumn)
+	return mode
+}
+
+// assignIDList - Assign generated ID to every row of slice
+func (cfg *Config) assignIDList(list interface{}) error {
+	if cfg.IDColumn == "" {
+		return nil
+	}
+
+	rVal := reflect.ValueOf(list)
+	if rVal.Kind() == reflect.Ptr {
+		rVal = rVal.Elem()
+	}
+	if rVal.Kind() != reflect.Slice {
+		return fmt.Errorf("Error assign ID: %T is not a slice", list)
+	}
+
+	for i := 0; i < rVal.Len(); i++ {
+		row := rVal.Index(i)
+		if row.Kind() != reflect.Ptr {
+			if !row.CanAddr() {
+				return fmt.Errorf("Error assign ID: row of %T is not addressable", list)
+			}
+			row = row.Addr()
+		}
+		err := cfg.AssignID(row.Interface())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldByTagDB - Find struct field with matching db tag, including embedded structs
+func fieldByTagDB(rVal reflect.Value, column string) (reflect.Value, bool) {
+	rType := rVal.Type()
+	for i := 0; i < rType.NumField(); i++ {
+		field := rType.Field(i)
+		tag := field.Tag.Get("db")
+		if tag == column {
+			return rVal.Field(i), true
+		}
+
+		if tag == "" && field.Type.Kind() == reflect.Struct {
+			if f, ok := fieldByTagDB(rVal.Field(i), column); ok {
+				return f, true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// setFieldString - Set generated string ID into field based on its kind
+func setFieldString(field reflect.Value, id string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(id)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(v)
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetUint(v)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("Error assign ID: unsupported field type %s", field.Type())
+		}
+		b, err := libid.ToBinary(id)
+		if err != nil {
+			return err
+		}
+		field.SetBytes(b)
+	default:
+		return fmt.Errorf("Error assign ID: unsupported field type %s", field.Type())
+	}
+	return nil
+}
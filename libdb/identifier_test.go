@@ -0,0 +1,49 @@
+package libdb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/helloferdie/golib/libid"
+)
+
+type identifierRow struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+func TestInsertKeepIDColumn(t *testing.T) {
+	cfg := Config{Table: "users", IDColumn: "id", IDGenerator: libid.GeneratorFunc(func() (string, error) {
+		return "42", nil
+	})}
+
+	for _, mode := range []Mode{DefaultMode, ModeAutoTimestamp} {
+		row := &identifierRow{Name: "alice"}
+		if err := cfg.AssignID(row); err != nil {
+			t.Fatal(err)
+		}
+		query, values := PrepareInsert(cfg.Table, row, cfg.insertMode(mode))
+		if !strings.Contains(query, "`id`") || values["id"] != int64(42) {
+			t.Fatalf("id not inserted: %s %v", query, values)
+		}
+
+		list := []identifierRow{{Name: "alice"}, {Name: "bob"}}
+		if err := cfg.assignIDList(list); err != nil {
+			t.Fatal(err)
+		}
+		query, values, err := PrepareInsertBulk(cfg.Table, list, cfg.insertMode(mode))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(query, "`id`") || values["id_0"] != int64(42) || values["id_1"] != int64(42) {
+			t.Fatalf("id not inserted in bulk: %s %v", query, values)
+		}
+	}
+
+	// Without IDColumn default mode still leave id to database
+	empty := Config{Table: "users"}
+	query, _ := PrepareInsert(empty.Table, &identifierRow{Name: "alice"}, empty.insertMode(DefaultMode))
+	if strings.Contains(query, "`id`") {
+		t.Fatalf("id inserted without IDColumn: %s", query)
+	}
+}
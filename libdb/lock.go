@@ -0,0 +1,136 @@
+package libdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/helloferdie/golib/liblogger"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrLockNotAcquired - Lock held by other session until timeout
+var ErrLockNotAcquired = errors.New("Error lock: not acquired")
+
+// Lock - Database advisory lock holding dedicated connection from pool
+type Lock struct {
+	Name string
+
+	conn   *sqlx.Conn
+	driver string
+	once   sync.Once
+	done   chan struct{}
+	err    error
+}
+
+// lockKey - Convert lock name into postgres advisory lock key
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// TryLock - Acquire advisory lock, wait up to timeout, released automatically when context cancelled
+//   - MySQL: GET_LOCK / RELEASE_LOCK, name is limited to 64 characters
+//   - Postgres: pg_try_advisory_lock / pg_advisory_unlock with key hashed from name
+func TryLock(ctx context.Context, d *sqlx.DB, name string, timeout time.Duration) (*Lock, error) {
+	conn, err := d.Connx(ctx)
+	if err != nil {
+		liblogger.Log(nil, true).Errorf("Error lock connection %v", err)
+		return nil, err
+	}
+
+	l := &Lock{Name: name, conn: conn, driver: d.DriverName(), done: make(chan struct{})}
+	acquired, err := l.acquire(ctx, timeout)
+	if err != nil || !acquired {
+		conn.Close()
+		if err == nil {
+			err = ErrLockNotAcquired
+		}
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.Release()
+		case <-l.done:
+		}
+	}()
+	return l, nil
+}
+
+// acquire -
+func (l *Lock) acquire(ctx context.Context, timeout time.Duration) (bool, error) {
+	if l.driver == "postgres" {
+		deadline := time.Now().Add(timeout)
+		for {
+			var acquired bool
+			err := l.conn.QueryRowxContext(ctx, "SELECT pg_try_advisory_lock($1)", lockKey(l.Name)).Scan(&acquired)
+			if err != nil || acquired {
+				return acquired, err
+			}
+			if !time.Now().Before(deadline) {
+				return false, nil
+			}
+
+			select {
+			case <-ctx.Done():
+				return false, ctx.Err()
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+
+	var acquired sql.NullInt64
+	seconds := int64(math.Ceil(timeout.Seconds()))
+	err := l.conn.QueryRowxContext(ctx, "SELECT GET_LOCK(?, ?)", l.Name, seconds).Scan(&acquired)
+	if err != nil {
+		return false, err
+	}
+	if !acquired.Valid {
+		return false, errors.New("Error lock: GET_LOCK returned NULL")
+	}
+	return acquired.Int64 == 1, nil
+}
+
+// Release - Release lock and return connection to pool, safe to call multiple times
+func (l *Lock) Release() error {
+	l.once.Do(func() {
+		close(l.done)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if l.driver == "postgres" {
+			_, l.err = l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockKey(l.Name))
+		} else {
+			_, l.err = l.conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", l.Name)
+		}
+		if l.err != nil {
+			liblogger.Log(nil, true).Errorf("Error release lock %s %v", l.Name, l.err)
+		}
+		l.conn.Close()
+	})
+	return l.err
+}
+
+// RunExclusive - Run fn only when lock acquired, return false without error when lock held by other instance
+func RunExclusive(ctx context.Context, d *sqlx.DB, name string, timeout time.Duration, fn func(ctx context.Context) error) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	l, err := TryLock(ctx, d, name, timeout)
+	if err == ErrLockNotAcquired {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer l.Release()
+	return true, fn(ctx)
+}
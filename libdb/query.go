@@ -1,7 +1,9 @@
 package libdb
 
 import (
+	"errors"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -19,6 +21,7 @@ type Mode struct {
 	Skip          []string
 	Only          []string
 	AutoTimestamp bool
+	keep          []string
 }
 
 // DefaultMode -
@@ -29,11 +32,21 @@ var ModeAutoTimestamp = Mode{
 	AutoTimestamp: true,
 }
 
-// PrepareInsert - Prepare insert query
+// PrepareInsert - Prepare insert query, columns follow struct field order
 func PrepareInsert(table string, data interface{}, mode Mode) (string, map[string]interface{}) {
+	col, dataMap := prepareInsertColumn(data, mode)
+	val := make([]string, 0, len(col))
+	for _, tag := range col {
+		val = append(val, ":"+tag)
+	}
+	return "INSERT INTO " + table + " (" + quoteColumn(col) + ") VALUES (" + strings.Join(val, ", ") + ")", dataMap
+}
+
+// prepareInsertColumn - Prepare ordered insert columns and its value named parameters
+func prepareInsertColumn(data interface{}, mode Mode) ([]string, map[string]interface{}) {
 	// Load mode
 	m := "skip"
-	var col, val, checkColumn []string
+	var col, checkColumn []string
 	if len(mode.Only) > 0 {
 		m = "only"
 		checkColumn = mode.Only
@@ -47,32 +60,80 @@ func PrepareInsert(table string, data interface{}, mode Mode) (string, map[strin
 
 	// Map columns and value named parameters
 	dataMap := MapTagDB(data, map[string]interface{}{})
-	for tag := range dataMap {
+	for _, tag := range ListTagDB(data, nil) {
 		_, exist := libslice.Contains(tag, checkColumn)
-		if (m == "only" && !exist) || (m == "skip" && exist) {
+		_, keep := libslice.Contains(tag, mode.keep)
+		if !keep && ((m == "only" && !exist) || (m == "skip" && exist)) {
 			delete(dataMap, tag)
 			continue
 		}
-
-		col = append(col, "`"+tag+"`")
-		val = append(val, ":"+tag)
+		col = append(col, tag)
 	}
 
 	// Manual assign timestamp
 	if m == "skip" && len(mode.Skip) == 0 && !mode.AutoTimestamp {
 		col = append(col, "created_at", "updated_at")
-		val = append(val, ":created_at", ":updated_at")
 		dataMap["created_at"] = time.Now().UTC()
 		dataMap["updated_at"] = time.Now().UTC()
 	}
-	return "INSERT INTO " + table + " (" + strings.Join(col, ", ") + ") VALUES (" + strings.Join(val, ", ") + ")", dataMap
+
+	// Encrypt crypt tagged columns
+	sealBlindIndex(data, dataMap)
+	sealMap(data, dataMap)
+	return col, dataMap
+}
+
+// PrepareInsertBulk - Prepare multiple rows insert query, list must be slice of struct or pointer to struct
+func PrepareInsertBulk(table string, list interface{}, mode Mode) (string, map[string]interface{}, error) {
+	rVal := reflect.ValueOf(list)
+	if rVal.Kind() == reflect.Ptr {
+		rVal = rVal.Elem()
+	}
+	if rVal.Kind() != reflect.Slice {
+		return "", nil, errors.New("Error prepare insert bulk: list is not a slice")
+	}
+	if rVal.Len() == 0 {
+		return "", nil, errors.New("Error prepare insert bulk: list is empty")
+	}
+
+	var col, rows []string
+	dataMap := map[string]interface{}{}
+	for i := 0; i < rVal.Len(); i++ {
+		rowCol, rowMap := prepareInsertColumn(rVal.Index(i).Interface(), mode)
+		if i == 0 {
+			col = rowCol
+		}
+
+		val := make([]string, 0, len(col))
+		for _, tag := range col {
+			named := tag + "_" + strconv.Itoa(i)
+			val = append(val, ":"+named)
+			dataMap[named] = rowMap[tag]
+		}
+		rows = append(rows, "("+strings.Join(val, ", ")+")")
+	}
+	return "INSERT INTO " + table + " (" + quoteColumn(col) + ") VALUES " + strings.Join(rows, ", "), dataMap, nil
 }
 
-// PrepareUpdate - Prepare update query
-func PrepareUpdate(table string, old interface{}, new interface{}, condition string, conditionVal map[string]interface{}, mode Mode) (string, map[string]interface{}, map[string]interface{}) {
+// quoteColumn - Join columns with backtick quote
+func quoteColumn(col []string) string {
+	quoted := make([]string, 0, len(col))
+	for _, tag := range col {
+		quoted = append(quoted, "`"+tag+"`")
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// PrepareUpdate - Prepare update query, columns follow struct field order
+func PrepareUpdate(table string, old interface{}, new interface{}, condition string, conditionVal map[string]interface{}, mode Mode) (string, map[string]interface{}, Diff) {
+	return PrepareUpdateDiff(table, old, new, condition, conditionVal, mode, DefaultDiffer)
+}
+
+// PrepareUpdateDiff - Prepare update query using custom differ, only changed columns are updated
+func PrepareUpdateDiff(table string, old interface{}, new interface{}, condition string, conditionVal map[string]interface{}, mode Mode, differ *Differ) (string, map[string]interface{}, Diff) {
 	// Load mode
 	m := "skip"
-	var col, val, checkColumn []string
+	var col, checkColumn []string
 	if len(mode.Only) > 0 {
 		m = "only"
 		checkColumn = mode.Only
@@ -84,42 +145,52 @@ func PrepareUpdate(table string, old interface{}, new interface{}, condition str
 		}
 	}
 
-	// Map columns and value named parameters
-	oldMap := MapTagDB(old, map[string]interface{}{})
-	newMap := MapTagDB(new, map[string]interface{}{})
-	dataMap := map[string]interface{}{}
-	diffMap := map[string]interface{}{}
-	for tag := range oldMap {
+	// Filter columns based on mode
+	for _, tag := range ListTagDB(old, nil) {
 		_, exist := libslice.Contains(tag, checkColumn)
 		if (m == "only" && !exist) || (m == "skip" && exist) {
 			continue
 		}
+		col = append(col, tag)
+	}
 
-		oldVal := oldMap[tag]
-		newVal := newMap[tag]
-		if oldVal == newVal {
-			continue
+	// Map columns and value named parameters
+	oldMap := MapTagDB(old, map[string]interface{}{})
+	newMap := MapTagDB(new, map[string]interface{}{})
+	sealBlindIndex(old, oldMap)
+	sealBlindIndex(new, newMap)
+	diff := differ.Compare(col, oldMap, newMap)
+	for _, cf := range listCryptField(new) {
+		for _, c := range []string{cf.Column, cf.Blind} {
+			if _, changed := diff[c]; changed {
+				diff[c] = DiffValue{Old: DiffMask, New: DiffMask}
+			}
 		}
-
-		col = append(col, "`"+tag+"` = :"+tag)
-		dataMap[tag] = newVal
-		diffMap[tag] = map[string]interface{}{
-			"o": oldVal,
-			"n": newVal,
+	}
+	dataMap := map[string]interface{}{}
+	set := []string{}
+	for _, tag := range col {
+		if _, changed := diff[tag]; !changed {
+			continue
 		}
+		set = append(set, "`"+tag+"` = :"+tag)
+		dataMap[tag] = newMap[tag]
 	}
 
 	// Manual assign timestamp
 	if m == "skip" && len(mode.Skip) == 0 && !mode.AutoTimestamp {
-		col = append(col, "updated_at = :updated_at")
-		val = append(val, ":updated_at")
+		set = append(set, "updated_at = :updated_at")
 		dataMap["updated_at"] = time.Now().UTC()
 	}
+	sealMap(new, dataMap)
 
 	for ck, cv := range conditionVal {
 		dataMap[ck] = cv
 	}
-	return "UPDATE " + table + " SET " + strings.Join(col, ", ") + " WHERE 1=1 " + condition, dataMap, diffMap
+
+	// Diff stays unredacted to drive update and history, tag actions carried for audit payload redaction
+	diff.WithRedactTag(new)
+	return "UPDATE " + table + " SET " + strings.Join(set, ", ") + " WHERE 1=1 " + condition, dataMap, diff
 }
 
 // PrepareInQuery - Prepare query for in condition
@@ -155,12 +226,18 @@ func PrepareOrderQuery(m *ModelPaginationRequest) (string, map[string]interface{
 	return strings.TrimSpace(s), v
 }
 
-// MapTagDB -
+// MapTagDB - Map struct db tag to its value, map[string]interface{} is copied as is
 func MapTagDB(t interface{}, result map[string]interface{}) map[string]interface{} {
 	rVal := reflect.ValueOf(t)
 	if rVal.Kind() == reflect.Ptr {
 		rVal = rVal.Elem()
 	}
+	if m, ok := rVal.Interface().(map[string]interface{}); ok {
+		for k, v := range m {
+			result[k] = v
+		}
+		return result
+	}
 	rType := rVal.Type()
 
 	for i := 0; i < rType.NumField(); i++ {
@@ -178,11 +255,48 @@ func MapTagDB(t interface{}, result map[string]interface{}) map[string]interface
 	return result
 }
 
+// ListTagDB - List db tag following struct field order, including embedded structs. Map keys are listed in sorted order
+func ListTagDB(t interface{}, result []string) []string {
+	rVal := reflect.ValueOf(t)
+	if rVal.Kind() == reflect.Ptr {
+		rVal = rVal.Elem()
+	}
+	if m, ok := rVal.Interface().(map[string]interface{}); ok {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			if _, exist := libslice.Contains(k, result); !exist {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		return append(result, keys...)
+	}
+	rType := rVal.Type()
+
+	for i := 0; i < rType.NumField(); i++ {
+		field := rType.Field(i)
+		tag := field.Tag.Get("db")
+		if tag != "" {
+			if _, exist := libslice.Contains(tag, result); !exist {
+				result = append(result, tag)
+			}
+			continue
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			result = ListTagDB(rVal.Field(i).Interface(), result)
+		}
+	}
+	return result
+}
+
 // ModelCondition -
+//   - Score: Relevance score select expressions added by full-text search, see Fields
 type ModelCondition struct {
 	Query string
 	Field []string
 	Value []interface{}
+	Score []string
 }
 
 // conditionBase -
@@ -261,6 +375,74 @@ func (mc *ModelCondition) GetValue() map[string]interface{} {
 	return m
 }
 
+// FullTextLanguage - Postgres text search configuration used by full-text search
+var FullTextLanguage = "simple"
+
+// fullTextBase - Build full-text search condition of driver (mysql or postgres, e.g. DriverName of connection) and optional relevance score column
+func (mc *ModelCondition) fullTextBase(driver string, columns []string, named string, term string, scoreAlias string, mode string, boolean bool) {
+	term = strings.TrimSpace(term)
+	if term == "" || len(columns) == 0 {
+		return
+	}
+	if named == "" {
+		named = "fulltext"
+	}
+
+	var match string
+	if driver == "postgres" {
+		doc := make([]string, 0, len(columns))
+		for _, c := range columns {
+			doc = append(doc, "COALESCE("+c+", '')")
+		}
+		tsQuery := "plainto_tsquery"
+		if boolean {
+			tsQuery = "websearch_to_tsquery"
+		}
+		vector := "to_tsvector('" + FullTextLanguage + "', " + strings.Join(doc, " || ' ' || ") + ")"
+		query := tsQuery + "('" + FullTextLanguage + "', :" + named + ")"
+		match = vector + " @@ " + query
+		if scoreAlias != "" {
+			mc.Score = append(mc.Score, "ts_rank("+vector+", "+query+") AS "+scoreAlias)
+		}
+	} else {
+		modifier := "IN NATURAL LANGUAGE MODE"
+		if boolean {
+			modifier = "IN BOOLEAN MODE"
+		}
+		match = "MATCH(" + strings.Join(columns, ", ") + ") AGAINST(:" + named + " " + modifier + ")"
+		if scoreAlias != "" {
+			mc.Score = append(mc.Score, match+" AS "+scoreAlias)
+		}
+	}
+
+	mc.Field = append(mc.Field, named)
+	mc.Value = append(mc.Value, term)
+	mc.Query += mode + " " + match + " "
+}
+
+// FullText - Full-text search in natural language mode, set scoreAlias to select relevance score
+func (mc *ModelCondition) FullText(driver string, columns []string, named string, term string, scoreAlias string) {
+	mc.fullTextBase(driver, columns, named, term, scoreAlias, "AND", false)
+}
+
+// FullTextBoolean - Full-text search in boolean mode (MySQL) or web search syntax (Postgres)
+func (mc *ModelCondition) FullTextBoolean(driver string, columns []string, named string, term string, scoreAlias string) {
+	mc.fullTextBase(driver, columns, named, term, scoreAlias, "AND", true)
+}
+
+// OrFullText -
+func (mc *ModelCondition) OrFullText(driver string, columns []string, named string, term string, scoreAlias string) {
+	mc.fullTextBase(driver, columns, named, term, scoreAlias, "OR", false)
+}
+
+// Fields - Append relevance score columns to select fields, score alias can be used as ModelPaginationRequest.OrderByField
+func (mc *ModelCondition) Fields(fields string) string {
+	if len(mc.Score) == 0 {
+		return fields
+	}
+	return fields + ", " + strings.Join(mc.Score, ", ")
+}
+
 // ValueLike -
 func ValueLike(val string) string {
 	return "%" + strings.ToLower(val) + "%"
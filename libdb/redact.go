@@ -0,0 +1,273 @@
+package libdb
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/helloferdie/golib/libsecret"
+	"github.com/helloferdie/golib/libslice"
+)
+
+// Redaction action, set per field with struct tag `audit:"-"`, `audit:"mask"` or `audit:"hash"`
+const (
+	RedactOmit = "-"
+	RedactMask = "mask"
+	RedactHash = "hash"
+)
+
+// RedactHashPrefix - Prefix of hashed value
+const RedactHashPrefix = "sha256:"
+
+// Redactor - Redaction rules applied to audit payload, struct tag takes precedence over column list
+//   - Omit: Columns removed from result
+//   - Mask: Columns replaced with DiffMask
+//   - Hash: Columns replaced with keyed SHA-256 (secret `redact_hash_key`), equal value produce equal hash, masked when key not configured
+//   - MaxLength: Maximum bytes of string value, longer value truncated with marker, 0 is unlimited
+type Redactor struct {
+	Omit      []string
+	Mask      []string
+	Hash      []string
+	MaxLength int
+}
+
+var redactorOnce sync.Once
+var defaultRedactor *Redactor
+var redactTagCache sync.Map
+
+// DefaultRedactor - Redactor loaded once from environment
+//   - redact_omit, redact_mask, redact_hash: Comma separated column names
+//   - redact_max_length: Maximum bytes of string value, default to 0 (unlimited)
+func DefaultRedactor() *Redactor {
+	redactorOnce.Do(func() {
+		r := &Redactor{
+			Omit: splitList(os.Getenv("redact_omit")),
+			Mask: splitList(os.Getenv("redact_mask")),
+			Hash: splitList(os.Getenv("redact_hash")),
+		}
+		r.MaxLength, _ = strconv.Atoi(os.Getenv("redact_max_length"))
+		defaultRedactor = r
+	})
+	return defaultRedactor
+}
+
+// splitList - Split comma separated list, empty item removed
+func splitList(s string) []string {
+	list := []string{}
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// GetRedactor - Get configured redactor, default to DefaultRedactor
+func (cfg *Config) GetRedactor() *Redactor {
+	if cfg.Redactor != nil {
+		return cfg.Redactor
+	}
+	return DefaultRedactor()
+}
+
+// RedactTag - Map `audit` struct tag action by db and json name, cached per type
+func RedactTag(t interface{}) map[string]string {
+	if t == nil {
+		return nil
+	}
+	rType := reflect.TypeOf(t)
+	for rType.Kind() == reflect.Ptr {
+		rType = rType.Elem()
+	}
+	if rType.Kind() != reflect.Struct {
+		return nil
+	}
+	if v, ok := redactTagCache.Load(rType); ok {
+		return v.(map[string]string)
+	}
+
+	tags := appendRedactTag(rType, map[string]string{})
+	redactTagCache.Store(rType, tags)
+	return tags
+}
+
+// appendRedactTag -
+func appendRedactTag(rType reflect.Type, tags map[string]string) map[string]string {
+	for i := 0; i < rType.NumField(); i++ {
+		field := rType.Field(i)
+		db := field.Tag.Get("db")
+		if db == "" && field.Anonymous && field.Type.Kind() == reflect.Struct {
+			appendRedactTag(field.Type, tags)
+			continue
+		}
+
+		action := field.Tag.Get("audit")
+		if action == "" {
+			continue
+		}
+		if db != "" {
+			tags[db] = action
+		}
+		if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+			tags[name] = action
+		}
+	}
+	return tags
+}
+
+// action - Resolve action of key, empty when value kept
+func (r *Redactor) action(key string, tags map[string]string) string {
+	if v, ok := tags[key]; ok {
+		return v
+	}
+	if _, ok := libslice.Contains(key, r.Omit); ok {
+		return RedactOmit
+	}
+	if _, ok := libslice.Contains(key, r.Mask); ok {
+		return RedactMask
+	}
+	if _, ok := libslice.Contains(key, r.Hash); ok {
+		return RedactHash
+	}
+	return ""
+}
+
+// value - Apply action on value, truncate long string when no action
+func (r *Redactor) value(action string, v interface{}) interface{} {
+	switch action {
+	case RedactMask:
+		return DiffMask
+	case RedactHash:
+		h, err := HashValue(v)
+		if err != nil {
+			// Fall back to mask rather than store guessable hash
+			return DiffMask
+		}
+		return h
+	}
+	return r.Truncate(v)
+}
+
+// Truncate - Truncate string longer than MaxLength recursively, marker appended with number of removed bytes
+func (r *Redactor) Truncate(v interface{}) interface{} {
+	if r.MaxLength <= 0 {
+		return v
+	}
+	switch t := v.(type) {
+	case string:
+		if len(t) <= r.MaxLength {
+			return t
+		}
+		n := r.MaxLength
+		for n > 0 && !utf8.RuneStart(t[n]) {
+			n--
+		}
+		return t[:n] + "...[truncated " + strconv.Itoa(len(t)-n) + " bytes]"
+	case []byte:
+		return r.Truncate(string(t))
+	case map[string]interface{}:
+		for k, item := range t {
+			t[k] = r.Truncate(item)
+		}
+	case []interface{}:
+		for k, item := range t {
+			t[k] = r.Truncate(item)
+		}
+	}
+	return v
+}
+
+// ErrRedactKey - Secret `redact_hash_key` not configured, unkeyed hash of low entropy value is brute-forceable
+var ErrRedactKey = errors.New("Error redact: hash key not configured")
+
+// HashValue - Keyed SHA-256 of value, string hashed as is and other value as JSON
+func HashValue(v interface{}) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	key := libsecret.Get("redact_hash_key")
+	if key == "" {
+		return "", ErrRedactKey
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		bt, _ := json.Marshal(v)
+		s = string(bt)
+	}
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(s))
+	return RedactHashPrefix + hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Map - Redact map in place using struct tag actions (see RedactTag) and column rules
+func (r *Redactor) Map(m map[string]interface{}, tags map[string]string) map[string]interface{} {
+	for k, v := range m {
+		action := r.action(k, tags)
+		if action == RedactOmit {
+			delete(m, k)
+			continue
+		}
+		m[k] = r.value(action, v)
+	}
+	return m
+}
+
+// Diff - Redacted copy of diff, original diff left untouched. Tag action carried by DiffValue takes precedence
+func (r *Redactor) Diff(df Diff, tags map[string]string) Diff {
+	result := make(Diff, len(df))
+	for k, v := range df {
+		action := v.Redact
+		if action == "" {
+			action = r.action(k, tags)
+		}
+		if action == RedactOmit {
+			continue
+		}
+		if v.Old == DiffMask && v.New == DiffMask {
+			result[k] = v
+			continue
+		}
+		result[k] = DiffValue{Old: r.value(action, v.Old), New: r.value(action, v.New)}
+	}
+	return result
+}
+
+// Payload - Redact arbitrary data for audit payload, result is JSON compatible
+func (r *Redactor) Payload(dt interface{}) interface{} {
+	if df, ok := dt.(Diff); ok {
+		return r.Diff(df, nil)
+	}
+
+	bt, err := json.Marshal(dt)
+	if err != nil {
+		return dt
+	}
+	// Keep number as is, int64 ID would lose precision as float64
+	var out interface{}
+	dec := json.NewDecoder(bytes.NewReader(bt))
+	dec.UseNumber()
+	if err := dec.Decode(&out); err != nil {
+		return dt
+	}
+	if m, ok := out.(map[string]interface{}); ok {
+		return r.Map(m, RedactTag(dt))
+	}
+	return r.Truncate(out)
+}
+
+// RedactPayload - Redact data for audit payload with configured redactor, diff is redacted with its carried tag actions
+func (cfg *Config) RedactPayload(dt interface{}) interface{} {
+	return cfg.GetRedactor().Payload(dt)
+}
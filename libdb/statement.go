@@ -0,0 +1,168 @@
+package libdb
+
+import (
+	"container/list"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// StatementStats - Prepared statement cache metrics of a connection
+type StatementStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Size      int   `json:"size"`
+	Capacity  int   `json:"capacity"`
+}
+
+// stmtEntry - Cached prepared statement, closed once evicted and no longer in use
+type stmtEntry struct {
+	query   string
+	stmt    *sqlx.NamedStmt
+	refs    int
+	evicted bool
+}
+
+// stmtCache - LRU cache of prepared named statements keyed by SQL text
+type stmtCache struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+	stats    StatementStats
+}
+
+var stmtCacheMu sync.Mutex
+var stmtCaches = map[*sqlx.DB]*stmtCache{}
+
+// stmtCacheCapacity - Load cache capacity from `db_stmt_cache_size`, default to 100, 0 to disable
+func stmtCacheCapacity() int {
+	v, err := strconv.Atoi(os.Getenv("db_stmt_cache_size"))
+	if err != nil || v < 0 {
+		return 100
+	}
+	return v
+}
+
+// getStmtCache - Get or create statement cache for connection
+func getStmtCache(d *sqlx.DB) *stmtCache {
+	stmtCacheMu.Lock()
+	defer stmtCacheMu.Unlock()
+
+	c, ok := stmtCaches[d]
+	if !ok {
+		c = &stmtCache{
+			capacity: stmtCacheCapacity(),
+			ll:       list.New(),
+			items:    map[string]*list.Element{},
+		}
+		stmtCaches[d] = c
+	}
+	return c
+}
+
+// PrepareNamed - Get prepared named statement from connection cache, call release once done with statement
+func PrepareNamed(d *sqlx.DB, query string) (*sqlx.NamedStmt, func(), error) {
+	c := getStmtCache(d)
+	if c.capacity == 0 {
+		nstmt, err := d.PrepareNamed(query)
+		if err != nil {
+			return nil, func() {}, err
+		}
+		return nstmt, func() { nstmt.Close() }, nil
+	}
+
+	c.mu.Lock()
+	if el, ok := c.items[query]; ok {
+		c.ll.MoveToFront(el)
+		e := el.Value.(*stmtEntry)
+		e.refs++
+		c.stats.Hits++
+		c.mu.Unlock()
+		return e.stmt, c.releaseFunc(e), nil
+	}
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	nstmt, err := d.PrepareNamed(query)
+	if err != nil {
+		return nil, func() {}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[query]; ok {
+		// Prepared concurrently by another caller, keep the cached one
+		nstmt.Close()
+		c.ll.MoveToFront(el)
+		e := el.Value.(*stmtEntry)
+		e.refs++
+		return e.stmt, c.releaseFunc(e), nil
+	}
+
+	e := &stmtEntry{query: query, stmt: nstmt, refs: 1}
+	c.items[query] = c.ll.PushFront(e)
+	for c.ll.Len() > c.capacity {
+		c.evict(c.ll.Back())
+	}
+	return e.stmt, c.releaseFunc(e), nil
+}
+
+// releaseFunc - Release reference of statement, close it when already evicted
+func (c *stmtCache) releaseFunc(e *stmtEntry) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			e.refs--
+			if e.evicted && e.refs == 0 {
+				e.stmt.Close()
+			}
+		})
+	}
+}
+
+// evict - Remove element from cache, must be called with lock held
+func (c *stmtCache) evict(el *list.Element) {
+	e := el.Value.(*stmtEntry)
+	c.ll.Remove(el)
+	delete(c.items, e.query)
+	c.stats.Evictions++
+	e.evicted = true
+	if e.refs == 0 {
+		e.stmt.Close()
+	}
+}
+
+// GetStatementStats - Get prepared statement cache metrics of connection
+func GetStatementStats(d *sqlx.DB) StatementStats {
+	c := getStmtCache(d)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.stats
+	s.Size = c.ll.Len()
+	s.Capacity = c.capacity
+	return s
+}
+
+// CloseStatements - Close all cached prepared statements of connection
+func CloseStatements(d *sqlx.DB) {
+	stmtCacheMu.Lock()
+	c, ok := stmtCaches[d]
+	delete(stmtCaches, d)
+	stmtCacheMu.Unlock()
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.ll.Len() > 0 {
+		c.evict(c.ll.Back())
+	}
+}
@@ -51,6 +51,11 @@ func TxGet(tx *sqlx.Tx, list interface{}, query string, values map[string]interf
 			liblogger.Log(nil, true).Errorf("Error scan row %v", err)
 			return exist, err
 		}
+		err = DecryptStruct(list)
+		if err != nil {
+			liblogger.Log(nil, true).Errorf("Error decrypt row %v", err)
+			return exist, err
+		}
 		exist = true
 	}
 	rows.Close()
@@ -86,18 +91,30 @@ func TxSelect(tx *sqlx.Tx, list interface{}, query string, values map[string]int
 		liblogger.Log(nil, true).Errorf("Error select prepare named query %v", err)
 		return err
 	}
+	defer nstmt.Close()
 	err = nstmt.Select(list, values)
 	if err != nil {
 		liblogger.Log(nil, true).Errorf("Error select query %v", err)
 		return err
 	}
+	err = DecryptStruct(list)
+	if err != nil {
+		liblogger.Log(nil, true).Errorf("Error decrypt rows %v", err)
+		return err
+	}
 	return nil
 }
 
 // TxCreate - Create from transaction query
 func TxCreate(tx *sqlx.Tx, cfg Config, dt interface{}, mode Mode, returnData bool) error {
+	err := cfg.AssignID(dt)
+	if err != nil {
+		liblogger.Log(nil, true).Errorf("Error assign ID %v", err)
+		return err
+	}
+
 	driver := tx.DriverName()
-	query, val := PrepareInsert(cfg.Table, dt, mode)
+	query, val := PrepareInsert(cfg.Table, dt, cfg.insertMode(mode))
 	if driver == "postgres" {
 		if returnData {
 			query += " RETURNING *"
@@ -112,8 +129,28 @@ func TxCreate(tx *sqlx.Tx, cfg Config, dt interface{}, mode Mode, returnData boo
 	return err
 }
 
+// TxCreateBulk - Create multiple rows from single transaction query
+func TxCreateBulk(tx *sqlx.Tx, cfg Config, list interface{}, mode Mode) error {
+	err := cfg.assignIDList(list)
+	if err != nil {
+		liblogger.Log(nil, true).Errorf("Error assign ID %v", err)
+		return err
+	}
+
+	query, val, err := PrepareInsertBulk(cfg.Table, list, cfg.insertMode(mode))
+	if err != nil {
+		liblogger.Log(nil, true).Error(err)
+		return err
+	}
+	_, err = tx.NamedExec(query, val)
+	if err != nil {
+		liblogger.Log(nil, true).Errorf("Error execute query %v", err)
+	}
+	return err
+}
+
 // TxUpdate - General update from transaction query
-func TxUpdate(tx *sqlx.Tx, cfg Config, old interface{}, new interface{}, mode Mode, pk interface{}, returnData bool) (map[string]interface{}, error) {
+func TxUpdate(tx *sqlx.Tx, cfg Config, old interface{}, new interface{}, mode Mode, pk interface{}, returnData bool) (Diff, error) {
 	diff, err := TxUpdateCustom(tx, cfg, old, new, mode, "AND id = :id ", map[string]interface{}{
 		"id": pk,
 	}, returnData)
@@ -121,9 +158,16 @@ func TxUpdate(tx *sqlx.Tx, cfg Config, old interface{}, new interface{}, mode Mo
 }
 
 // TxUpdateCustom - Custom update from transaction query
-func TxUpdateCustom(tx *sqlx.Tx, cfg Config, old interface{}, new interface{}, mode Mode, condition string, conditionVal map[string]interface{}, returnData bool) (map[string]interface{}, error) {
+func TxUpdateCustom(tx *sqlx.Tx, cfg Config, old interface{}, new interface{}, mode Mode, condition string, conditionVal map[string]interface{}, returnData bool) (Diff, error) {
 	driver := tx.DriverName()
-	query, val, diff := PrepareUpdate(cfg.Table, old, new, condition, conditionVal, mode)
+	query, val, diff := PrepareUpdateDiff(cfg.Table, old, new, condition, conditionVal, mode, cfg.differ())
+	if len(diff) > 0 {
+		err := txHistory(tx, cfg, condition, conditionVal, "update")
+		if err != nil {
+			return diff, err
+		}
+	}
+
 	if driver == "postgres" {
 		if returnData {
 			query += " RETURNING *"
@@ -131,9 +175,9 @@ func TxUpdateCustom(tx *sqlx.Tx, cfg Config, old interface{}, new interface{}, m
 		_, err := TxGet(tx, new, query, val)
 		return diff, err
 	}
-	id, _, err := TxExec(tx, query, val)
-	if returnData {
-		_, err = TxGetByID(tx, cfg, new, id)
+	_, _, err := TxExec(tx, query, val)
+	if err == nil && returnData {
+		_, err = TxGetByField(tx, cfg, new, conditionVal, condition)
 	}
 	return diff, err
 }
@@ -145,8 +189,13 @@ func TxDelete(tx *sqlx.Tx, cfg Config, pk interface{}) error {
 
 // TxDeleteCustom - Custom delete from transaction query
 func TxDeleteCustom(tx *sqlx.Tx, cfg Config, condition string, conditionVal map[string]interface{}) error {
+	err := txHistory(tx, cfg, condition, conditionVal, "delete")
+	if err != nil {
+		return err
+	}
+
 	query := "DELETE FROM " + cfg.Table + " WHERE 1=1 " + condition
-	_, err := tx.NamedExec(query, conditionVal)
+	_, err = tx.NamedExec(query, conditionVal)
 	return err
 }
 
@@ -175,7 +224,17 @@ func TxSoftDeleteCustom(tx *sqlx.Tx, cfg Config, condition string, conditionVal
 		condition += "AND deleted_at IS NULL "
 		conditionVal["deleted_at"] = time.Now().UTC()
 	}
+
+	operation := "softdelete"
+	if revoke {
+		operation = "unsoftdelete"
+	}
+	err := txHistory(tx, cfg, condition, conditionVal, operation)
+	if err != nil {
+		return err
+	}
+
 	query := "UPDATE " + cfg.Table + " SET updated_at = NOW(), " + delQuery + " WHERE 1=1 " + condition
-	_, err := tx.NamedExec(query, conditionVal)
+	_, err = tx.NamedExec(query, conditionVal)
 	return err
 }
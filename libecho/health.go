@@ -0,0 +1,49 @@
+package libecho
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/helloferdie/golib/libresponse"
+	"github.com/labstack/echo/v4"
+)
+
+// ReadinessCheck - Return false when dependency is not ready, detail is included in response data
+type ReadinessCheck func(ctx context.Context) (bool, interface{})
+
+// Readiness - Readiness handler running every check, respond 503 when any check fails
+func Readiness(checks map[string]ReadinessCheck, timeout time.Duration) echo.HandlerFunc {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return func(c echo.Context) error {
+		ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+		defer cancel()
+
+		ready := true
+		data := map[string]interface{}{}
+		for _, name := range names {
+			ok, detail := checks[name](ctx)
+			if !ok {
+				ready = false
+			}
+			data[name] = map[string]interface{}{
+				"ready":  ok,
+				"detail": detail,
+			}
+		}
+
+		response := libresponse.GetDefault()
+		if ready {
+			response.SuccessDefault()
+		} else {
+			response.ErrorUnavailable()
+		}
+		response.Data = data
+		return ParseResponse(c, response)
+	}
+}
@@ -1,7 +1,10 @@
 package libmiddleware
 
 import (
+	"github.com/helloferdie/golib/libactor"
 	"github.com/helloferdie/golib/libecho"
+	"github.com/helloferdie/golib/libid"
+	"github.com/helloferdie/golib/libjwt"
 	"github.com/helloferdie/golib/libresponse"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -32,3 +35,48 @@ func VerifyHeaderSecret(config VerifyHeaderSecretConfig) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// ActorConfig - Actor middleware configuration
+//   - RequestIDHeader: Header carrying correlation ID, default to X-Request-Id, generated when empty
+type ActorConfig struct {
+	Skipper         middleware.Skipper
+	RequestIDHeader string
+}
+
+// Actor - Capture JWT user, client IP, user agent and request ID into request context, read with libactor.FromContext.
+// Register after JWT middleware
+func Actor(config ActorConfig) echo.MiddlewareFunc {
+	if config.RequestIDHeader == "" {
+		config.RequestIDHeader = echo.HeaderXRequestID
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			if config.Skipper != nil && config.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			requestID := req.Header.Get(config.RequestIDHeader)
+			if requestID == "" {
+				requestID = c.Response().Header().Get(config.RequestIDHeader)
+			}
+			if requestID == "" {
+				requestID, _ = libid.UUIDv4.Generate()
+			}
+			c.Response().Header().Set(config.RequestIDHeader, requestID)
+
+			claims := libjwt.Parse(libecho.GetJWTClaims(c))
+			a := &libactor.Actor{
+				UserID:    claims.UserID,
+				TokenID:   claims.ID,
+				Access:    claims.Access,
+				IP:        libecho.GetRealIP(c),
+				UserAgent: req.UserAgent(),
+				RequestID: requestID,
+			}
+			c.SetRequest(req.WithContext(libactor.WithActor(req.Context(), a)))
+			return next(c)
+		}
+	}
+}
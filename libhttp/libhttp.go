@@ -1,6 +1,7 @@
 package libhttp
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 
@@ -48,17 +49,22 @@ func Request(address string, method string, payloadData map[string]interface{},
 
 // RequestRaw - request HTTP and expect response in raw string
 func RequestRaw(address string, method string, payloadData map[string]interface{}, headerData map[string]string) (string, int, error) {
+	return RequestRawContext(context.Background(), address, method, payloadData, headerData)
+}
+
+// RequestRawContext - request HTTP bound to context and expect response in raw string
+func RequestRawContext(ctx context.Context, address string, method string, payloadData map[string]interface{}, headerData map[string]string) (string, int, error) {
 	payloadBytes, _ := json.Marshal(payloadData)
 	payload := strings.NewReader(string(payloadBytes))
-	request, err := http.NewRequest(method, address, payload)
-	request.Header.Add("Content-Type", "application/json")
-	for k, v := range headerData {
-		request.Header.Add(k, v)
-	}
+	request, err := http.NewRequestWithContext(ctx, method, address, payload)
 	if err != nil {
 		liblogger.Log(nil, false).Errorf("%v\n", err)
 		return "", 0, err
 	}
+	request.Header.Add("Content-Type", "application/json")
+	for k, v := range headerData {
+		request.Header.Add(k, v)
+	}
 
 	response, err := http.DefaultClient.Do(request)
 	if err != nil {
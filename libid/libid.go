@@ -0,0 +1,136 @@
+package libid
+
+import (
+	"crypto/rand"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sony/sonyflake"
+)
+
+// Generator - Generate unique identifier for new row
+type Generator interface {
+	Generate() (string, error)
+}
+
+// GeneratorFunc - Adapter to use ordinary function as Generator
+type GeneratorFunc func() (string, error)
+
+// Generate -
+func (f GeneratorFunc) Generate() (string, error) {
+	return f()
+}
+
+// UUIDv4 - Random UUID generator
+var UUIDv4 = GeneratorFunc(func() (string, error) {
+	u, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+})
+
+// UUIDv7 - Time-ordered UUID generator (RFC 9562)
+var UUIDv7 = GeneratorFunc(func() (string, error) {
+	u, err := NewUUIDv7(time.Now())
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+})
+
+// ULID - Lexicographically sortable identifier generator
+var ULID = GeneratorFunc(func() (string, error) {
+	return NewULID(time.Now())
+})
+
+// NewUUIDv7 - Generate UUIDv7 with unix milliseconds from given time
+func NewUUIDv7(t time.Time) (uuid.UUID, error) {
+	var u uuid.UUID
+	if _, err := rand.Read(u[6:]); err != nil {
+		return u, err
+	}
+
+	ms := uint64(t.UnixMilli())
+	u[0] = byte(ms >> 40)
+	u[1] = byte(ms >> 32)
+	u[2] = byte(ms >> 24)
+	u[3] = byte(ms >> 16)
+	u[4] = byte(ms >> 8)
+	u[5] = byte(ms)
+	u[6] = (u[6] & 0x0f) | 0x70 // Version 7
+	u[8] = (u[8] & 0x3f) | 0x80 // Variant RFC 4122
+	return u, nil
+}
+
+// Sonyflake - Sonyflake based numeric generator
+type Sonyflake struct {
+	Settings sonyflake.Settings
+
+	once sync.Once
+	sf   *sonyflake.Sonyflake
+	mu   sync.RWMutex
+	err  error
+}
+
+// DefaultStartTime - Default sonyflake epoch, shared with libaudittrail
+var DefaultStartTime = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// NextID - Generate next sonyflake ID
+func (g *Sonyflake) NextID() (uint64, error) {
+	g.once.Do(func() {
+		st := g.Settings
+		if st.StartTime.IsZero() {
+			st.StartTime = DefaultStartTime
+		}
+		g.sf = sonyflake.NewSonyflake(st)
+	})
+	if g.sf == nil {
+		return 0, errors.New("Error sonyflake: invalid settings or machine ID")
+	}
+
+	g.mu.RLock()
+	err := g.err
+	g.mu.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+	return g.sf.NextID()
+}
+
+// setErr - Stop generator, every next call return err
+func (g *Sonyflake) setErr(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.err = err
+}
+
+// Generate -
+func (g *Sonyflake) Generate() (string, error) {
+	id, err := g.NextID()
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(id, 10), nil
+}
+
+// ToBinary - Convert UUID or ULID string to 16 bytes for binary(16) storage
+func ToBinary(id string) ([]byte, error) {
+	switch len(id) {
+	case 26:
+		b, err := ParseULID(id)
+		if err != nil {
+			return nil, err
+		}
+		return b[:], nil
+	default:
+		u, err := uuid.Parse(id)
+		if err != nil {
+			return nil, err
+		}
+		return u[:], nil
+	}
+}
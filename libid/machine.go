@@ -0,0 +1,373 @@
+package libid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/helloferdie/golib/liblogger"
+	"github.com/helloferdie/golib/libredis"
+	"github.com/jmoiron/sqlx"
+	"github.com/sony/sonyflake"
+)
+
+// Machine ID source
+//   - MachineSourceAuto: Env when `id_machine_id` is set, otherwise private IP. Hostname ordinal is never guessed,
+//     default hostname such as `ip-10-0-1-23` and `ip-10-0-2-23` would collide
+//   - MachineSourceEnv: `id_machine_id`
+//   - MachineSourceOrdinal: Ordinal suffix of hostname, e.g. `api-3` of StatefulSet, only when set explicitly
+//   - MachineSourceIP: Lower 16 bits of private IPv4
+//   - MachineSourceLease: First free ID claimed in registry
+const (
+	MachineSourceAuto    = "auto"
+	MachineSourceEnv     = "env"
+	MachineSourceOrdinal = "ordinal"
+	MachineSourceIP      = "ip"
+	MachineSourceLease   = "lease"
+)
+
+// ErrMachineCollision - Machine ID already held by another instance
+var ErrMachineCollision = errors.New("Error machine ID: already claimed by another instance")
+
+// ErrMachineExhausted - No free machine ID left to lease
+var ErrMachineExhausted = errors.New("Error machine ID: no free ID to lease")
+
+// ErrMachineLost - Lease of machine ID lost, generator stopped to avoid duplicate ID
+var ErrMachineLost = errors.New("Error machine ID: lease lost")
+
+// MachineRegistry - Shared registry of claimed machine ID, used for lease and collision detection
+type MachineRegistry interface {
+	// Claim - Claim or renew ID for owner until ttl expires, false when held by another owner
+	Claim(ctx context.Context, id uint16, owner string, ttl time.Duration) (bool, error)
+	// Release - Release ID held by owner
+	Release(ctx context.Context, id uint16, owner string) error
+}
+
+// MachineConfig - Machine ID configuration
+//   - Source: See MachineSource*, default to MachineSourceAuto
+//   - ID: Machine ID of MachineSourceEnv
+//   - Registry: Claim resolved ID on startup to detect collision, required by MachineSourceLease
+//   - Owner: Registry owner, default to hostname and process ID
+//   - TTL: Registry claim duration, renewed every third of TTL, default to 1 minute
+//   - Max: Highest ID of MachineSourceLease, default to 1023
+type MachineConfig struct {
+	Source   string
+	ID       uint16
+	Registry MachineRegistry
+	Owner    string
+	TTL      time.Duration
+	Max      uint16
+}
+
+// LoadMachineConfig - Load configuration from `id_machine_source`, `id_machine_id`, `id_machine_ttl_seconds` and `id_machine_max`
+func LoadMachineConfig() MachineConfig {
+	cfg := MachineConfig{Source: os.Getenv("id_machine_source")}
+	if v, err := strconv.ParseUint(os.Getenv("id_machine_id"), 10, 16); err == nil {
+		cfg.ID = uint16(v)
+		if cfg.Source == "" {
+			cfg.Source = MachineSourceEnv
+		}
+	}
+	if v, err := strconv.Atoi(os.Getenv("id_machine_ttl_seconds")); err == nil && v > 0 {
+		cfg.TTL = time.Duration(v) * time.Second
+	}
+	if v, err := strconv.ParseUint(os.Getenv("id_machine_max"), 10, 16); err == nil {
+		cfg.Max = uint16(v)
+	}
+	return cfg
+}
+
+// defaultMachineConfig - Fill default value
+func (cfg *MachineConfig) defaultMachineConfig() {
+	if cfg.Source == "" {
+		cfg.Source = MachineSourceAuto
+	}
+	if cfg.Owner == "" {
+		host, _ := os.Hostname()
+		cfg.Owner = host + ":" + strconv.Itoa(os.Getpid())
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = time.Minute
+	}
+	if cfg.Max == 0 {
+		cfg.Max = 1023
+	}
+}
+
+// ResolveMachineID - Resolve machine ID from configured source without claiming it
+func ResolveMachineID(cfg MachineConfig) (uint16, error) {
+	cfg.defaultMachineConfig()
+	switch cfg.Source {
+	case MachineSourceEnv:
+		return cfg.ID, nil
+	case MachineSourceOrdinal:
+		return hostOrdinal()
+	case MachineSourceIP:
+		return privateIP()
+	case MachineSourceAuto:
+		if os.Getenv("id_machine_id") != "" {
+			return cfg.ID, nil
+		}
+		return privateIP()
+	}
+	return 0, errors.New("Error machine ID: unsupported source " + cfg.Source)
+}
+
+// hostOrdinal - Parse ordinal suffix of hostname
+func hostOrdinal() (uint16, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return 0, err
+	}
+	k := strings.LastIndex(host, "-")
+	if k < 0 {
+		return 0, fmt.Errorf("Error machine ID: hostname %s has no ordinal", host)
+	}
+	v, err := strconv.ParseUint(host[k+1:], 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("Error machine ID: hostname %s has no ordinal", host)
+	}
+	return uint16(v), nil
+}
+
+// privateIP - Lower 16 bits of first private IPv4 address
+func privateIP() (uint16, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return 0, err
+	}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() {
+			continue
+		}
+		ip := ipnet.IP.To4()
+		if ip != nil && ip.IsPrivate() {
+			return uint16(ip[2])<<8 + uint16(ip[3]), nil
+		}
+	}
+	return 0, errors.New("Error machine ID: no private IP address")
+}
+
+// NewSonyflake - Create sonyflake generator with configured machine ID.
+// When registry is set, ID is claimed on startup and renewed until context cancelled, then released
+func NewSonyflake(ctx context.Context, cfg MachineConfig) (*Sonyflake, error) {
+	cfg.defaultMachineConfig()
+
+	var id uint16
+	var err error
+	if cfg.Source == MachineSourceLease {
+		if cfg.Registry == nil {
+			return nil, errors.New("Error machine ID: lease requires registry")
+		}
+		id, err = leaseMachineID(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		id, err = ResolveMachineID(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Registry != nil {
+			ok, err := cfg.Registry.Claim(ctx, id, cfg.Owner, cfg.TTL)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, fmt.Errorf("%w: %d", ErrMachineCollision, id)
+			}
+		}
+	}
+
+	g := &Sonyflake{Settings: sonyflake.Settings{
+		MachineID: func() (uint16, error) {
+			return id, nil
+		},
+	}}
+	if cfg.Registry != nil {
+		go g.renew(ctx, cfg, id)
+	}
+	return g, nil
+}
+
+// leaseMachineID - Claim first free ID, scan start from hash of owner to spread concurrent startup
+func leaseMachineID(ctx context.Context, cfg MachineConfig) (uint16, error) {
+	h := fnv.New32a()
+	h.Write([]byte(cfg.Owner))
+	total := uint32(cfg.Max) + 1
+	start := h.Sum32() % total
+
+	for i := uint32(0); i < total; i++ {
+		id := uint16((start + i) % total)
+		ok, err := cfg.Registry.Claim(ctx, id, cfg.Owner, cfg.TTL)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return id, nil
+		}
+	}
+	return 0, ErrMachineExhausted
+}
+
+// renew - Renew claim until context cancelled, stop generator when lease lost
+func (g *Sonyflake) renew(ctx context.Context, cfg MachineConfig, id uint16) {
+	ticker := time.NewTicker(cfg.TTL / 3)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := cfg.Registry.Release(context.Background(), id, cfg.Owner); err != nil {
+				liblogger.Log(nil, true).Errorf("Error release machine ID %d %v", id, err)
+			}
+			return
+		case <-ticker.C:
+			attempt := time.Now()
+			ok, err := cfg.Registry.Claim(ctx, id, cfg.Owner, cfg.TTL)
+			if err != nil {
+				// Transient failure, claim is still valid until TTL expires. Stop before next tick could pass expiry,
+				// after that another instance may claim the same ID
+				liblogger.Log(nil, true).Errorf("Error renew machine ID %d %v", id, err)
+				if time.Since(renewed)+cfg.TTL/3 >= cfg.TTL {
+					g.setErr(ErrMachineLost)
+					return
+				}
+				continue
+			}
+			if !ok {
+				liblogger.Log(nil, true).Errorf("Error renew machine ID %d %v", id, ErrMachineLost)
+				g.setErr(ErrMachineLost)
+				return
+			}
+			renewed = attempt
+		}
+	}
+}
+
+// RedisRegistry - Machine ID registry in redis, key `<Prefix><id>` expire with TTL
+type RedisRegistry struct {
+	Client *libredis.Client
+	Prefix string
+}
+
+// key -
+func (r *RedisRegistry) key(id uint16) string {
+	prefix := r.Prefix
+	if prefix == "" {
+		prefix = "id_machine:"
+	}
+	return prefix + strconv.Itoa(int(id))
+}
+
+// Claim -
+func (r *RedisRegistry) Claim(ctx context.Context, id uint16, owner string, ttl time.Duration) (bool, error) {
+	return r.Client.Lease(r.key(id), owner, ttl)
+}
+
+// Release -
+func (r *RedisRegistry) Release(ctx context.Context, id uint16, owner string) error {
+	return r.Client.Unlease(r.key(id), owner)
+}
+
+// SQLRegistry - Machine ID registry in table with columns machine_id (primary key), owner and expired_at
+type SQLRegistry struct {
+	DB    *sqlx.DB
+	Table string
+}
+
+// table -
+func (r *SQLRegistry) table() string {
+	if r.Table == "" {
+		return "id_machine"
+	}
+	return r.Table
+}
+
+// Claim -
+func (r *SQLRegistry) Claim(ctx context.Context, id uint16, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	values := map[string]interface{}{
+		"machine_id": int(id),
+		"owner":      owner,
+		"expired_at": now.Add(ttl),
+		"now":        now,
+	}
+
+	res, err := r.DB.NamedExecContext(ctx, "UPDATE "+r.table()+" SET owner = :owner, expired_at = :expired_at WHERE machine_id = :machine_id AND (owner = :owner OR expired_at < :now)", values)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return true, nil
+	}
+
+	_, err = r.DB.NamedExecContext(ctx, "INSERT INTO "+r.table()+" (machine_id, owner, expired_at) VALUES (:machine_id, :owner, :expired_at)", values)
+	if err == nil {
+		return true, nil
+	}
+
+	// Duplicate key, or MySQL reporting zero affected row on unchanged renewal
+	var current string
+	q, args, err := sqlx.Named("SELECT owner FROM "+r.table()+" WHERE machine_id = :machine_id", values)
+	if err != nil {
+		return false, err
+	}
+	err = r.DB.QueryRowxContext(ctx, r.DB.Rebind(q), args...).Scan(&current)
+	if err != nil {
+		return false, err
+	}
+	return current == owner, nil
+}
+
+// Release -
+func (r *SQLRegistry) Release(ctx context.Context, id uint16, owner string) error {
+	_, err := r.DB.NamedExecContext(ctx, "DELETE FROM "+r.table()+" WHERE machine_id = :machine_id AND owner = :owner", map[string]interface{}{
+		"machine_id": int(id),
+		"owner":      owner,
+	})
+	return err
+}
+
+var defaultSonyflakeMu sync.Mutex
+var defaultSonyflake *Sonyflake
+
+// SetDefaultSonyflake - Register generator returned by DefaultSonyflake, e.g. created by NewSonyflake with registry
+func SetDefaultSonyflake(g *Sonyflake) {
+	defaultSonyflakeMu.Lock()
+	defer defaultSonyflakeMu.Unlock()
+	defaultSonyflake = g
+}
+
+// DefaultSonyflake - Shared sonyflake generator, created from LoadMachineConfig without registry when not registered
+func DefaultSonyflake() (*Sonyflake, error) {
+	defaultSonyflakeMu.Lock()
+	defer defaultSonyflakeMu.Unlock()
+	if defaultSonyflake != nil {
+		return defaultSonyflake, nil
+	}
+
+	g, err := NewSonyflake(context.Background(), LoadMachineConfig())
+	if err != nil {
+		return nil, err
+	}
+	defaultSonyflake = g
+	return g, nil
+}
+
+// SonyflakeID - Generator using DefaultSonyflake
+var SonyflakeID = GeneratorFunc(func() (string, error) {
+	g, err := DefaultSonyflake()
+	if err != nil {
+		return "", err
+	}
+	return g.Generate()
+})
@@ -0,0 +1,155 @@
+package libid
+
+import (
+	"crypto/rand"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// crockford - Crockford base32 alphabet used by ULID
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID - Generate ULID with unix milliseconds from given time
+func NewULID(t time.Time) (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+
+	ms := uint64(t.UnixMilli())
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	b[2] = byte(ms >> 24)
+	b[3] = byte(ms >> 16)
+	b[4] = byte(ms >> 8)
+	b[5] = byte(ms)
+	return encodeULID(b), nil
+}
+
+// encodeULID - Encode 128 bits into 26 characters of Crockford base32
+func encodeULID(b [16]byte) string {
+	out := make([]byte, 26)
+	// 130 bits of output, the first character only carries the top 3 bits
+	var acc uint64
+	bits := 2
+	idx := 0
+	for _, v := range b {
+		acc = acc<<8 | uint64(v)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			out[idx] = crockford[(acc>>uint(bits))&0x1f]
+			idx++
+		}
+	}
+	return string(out)
+}
+
+// ParseULID - Decode ULID string into 16 bytes
+func ParseULID(s string) ([16]byte, error) {
+	var b [16]byte
+	if len(s) != 26 {
+		return b, errors.New("Error parse ULID: invalid length")
+	}
+
+	s = strings.ToUpper(s)
+	if s[0] > '7' {
+		return b, errors.New("Error parse ULID: overflow")
+	}
+
+	var acc uint64
+	bits := -2
+	idx := 0
+	for i := 0; i < len(s); i++ {
+		v := strings.IndexByte(crockford, s[i])
+		if v < 0 {
+			return b, fmt.Errorf("Error parse ULID: invalid character %q", s[i])
+		}
+		acc = acc<<5 | uint64(v)
+		bits += 5
+		if bits >= 8 {
+			bits -= 8
+			b[idx] = byte(acc >> uint(bits))
+			idx++
+		}
+	}
+	return b, nil
+}
+
+// Binary - UUID string stored as binary(16) column, convert on write and scan. Use BinaryULID for ULID
+type Binary string
+
+// Value - Implement driver.Valuer
+func (b Binary) Value() (driver.Value, error) {
+	if b == "" {
+		return nil, nil
+	}
+	u, err := uuid.Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("Error binary ID: %s is not UUID %v", string(b), err)
+	}
+	return u[:], nil
+}
+
+// Scan - Implement sql.Scanner
+func (b *Binary) Scan(src interface{}) error {
+	return scanBinary(src, (*string)(b), func(v []byte) (string, error) {
+		u, err := uuid.FromBytes(v)
+		if err != nil {
+			return "", err
+		}
+		return u.String(), nil
+	})
+}
+
+// BinaryULID - ULID string stored as binary(16) column, convert on write and scan
+type BinaryULID string
+
+// Value - Implement driver.Valuer
+func (b BinaryULID) Value() (driver.Value, error) {
+	if b == "" {
+		return nil, nil
+	}
+	v, err := ParseULID(string(b))
+	if err != nil {
+		return nil, err
+	}
+	return v[:], nil
+}
+
+// Scan - Implement sql.Scanner
+func (b *BinaryULID) Scan(src interface{}) error {
+	return scanBinary(src, (*string)(b), func(v []byte) (string, error) {
+		var u [16]byte
+		copy(u[:], v)
+		return encodeULID(u), nil
+	})
+}
+
+// scanBinary - Scan binary(16) column with format decoder, other length and string kept as is
+func scanBinary(src interface{}, dst *string, decode func(v []byte) (string, error)) error {
+	switch v := src.(type) {
+	case nil:
+		*dst = ""
+	case []byte:
+		if len(v) != 16 {
+			*dst = string(v)
+			return nil
+		}
+		s, err := decode(v)
+		if err != nil {
+			return err
+		}
+		*dst = s
+	case string:
+		*dst = v
+	default:
+		return fmt.Errorf("Error scan binary ID: unsupported type %T", src)
+	}
+	return nil
+}
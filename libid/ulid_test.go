@@ -0,0 +1,59 @@
+package libid
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		id, err := UUIDv7.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := Binary(id).Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b Binary
+		if err := b.Scan(v); err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != id {
+			t.Fatalf("UUIDv7 %s read back as %s", id, b)
+		}
+	}
+}
+
+func TestBinaryULIDRoundTrip(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		id, err := ULID.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := BinaryULID(id).Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b BinaryULID
+		if err := b.Scan(v); err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != id {
+			t.Fatalf("ULID %s read back as %s", id, b)
+		}
+
+		// Lowercase input is stored as canonical uppercase
+		v, err = BinaryULID(strings.ToLower(id)).Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Scan(v); err != nil || string(b) != id {
+			t.Fatalf("lowercase ULID %s read back as %s %v", id, b, err)
+		}
+	}
+
+	if _, err := Binary("01ARZ3NDEKTSV4RRFFQ69G5FAV").Value(); err == nil {
+		t.Fatal("ULID accepted as UUID binary")
+	}
+}
@@ -3,9 +3,11 @@ package libjwt
 import (
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/helloferdie/golib/libsecret"
 )
 
 // Config - JWT configuration
@@ -16,14 +18,26 @@ type Config struct {
 	RefreshTokenExpiry time.Duration
 }
 
+var configMu sync.Mutex
 var initialize = false
+var watchSecret = false
 var cfg = Config{}
 
-// loadConfig - Load initial configuration
-func loadConfig() {
+// loadConfig - Load configuration once, reloaded after secret rotated, return copy safe for concurrent use
+func loadConfig() Config {
+	configMu.Lock()
+	defer configMu.Unlock()
 	if !initialize {
-		cfg.Secret = os.Getenv("jwt_secret")
+		cfg.Secret = libsecret.Get("jwt_secret")
 		cfg.SecretByte = []byte(cfg.Secret)
+		if !watchSecret {
+			libsecret.OnChange("jwt_secret", func(string) {
+				configMu.Lock()
+				defer configMu.Unlock()
+				initialize = false
+			})
+			watchSecret = true
+		}
 
 		expiry, err := strconv.ParseInt(os.Getenv("jwt_expiry_minutes"), 10, 64)
 		if err != nil {
@@ -38,17 +52,17 @@ func loadConfig() {
 		cfg.RefreshTokenExpiry = time.Duration(refreshExpiry)
 		initialize = true
 	}
+	return cfg
 }
 
 // GetByte - Get JWT secret in byte format
 func GetByte() []byte {
-	loadConfig()
-	return cfg.SecretByte
+	return loadConfig().SecretByte
 }
 
 // Generate -
 func Generate(dtMain map[string]interface{}, dtRefresh map[string]interface{}) map[string]interface{} {
-	loadConfig()
+	cfg := loadConfig()
 	expiry := time.Now().UTC().Add(time.Minute * cfg.TokenExpiry)
 	//expiry := time.Now().UTC().Add(time.Second * 10) // Shorter JWT token, for debug purpose
 	refreshExpiry := time.Now().UTC().Add(time.Hour * 24 * cfg.RefreshTokenExpiry)
@@ -0,0 +1,19 @@
+package liboutbox
+
+import (
+	"strings"
+
+	"github.com/helloferdie/golib/libdb"
+	"github.com/helloferdie/golib/libid"
+	"github.com/helloferdie/golib/libslice"
+)
+
+var dbMode = libdb.Mode{Skip: []string{"updated_at", "deleted_at"}, AutoTimestamp: true}
+
+// TConfig -
+var TConfig = libdb.Config{
+	Table:       "outbox",
+	Fields:      strings.Join(libslice.GetTagSlice(Model{}, "db"), ", "),
+	IDColumn:    "id",
+	IDGenerator: libid.UUIDv7,
+}
@@ -0,0 +1,38 @@
+package liboutbox
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/helloferdie/golib/libdb"
+	"github.com/helloferdie/golib/liblogger"
+	"github.com/jmoiron/sqlx"
+)
+
+// Prepare - Prepare outbox event with JSON payload
+func Prepare(topic string, key string, payload interface{}) (*Model, error) {
+	bt, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	m := new(Model)
+	m.Topic = topic
+	m.EventKey = key
+	m.Payload = string(bt)
+	m.CreatedAt.Valid = true
+	m.CreatedAt.Time = time.Now().UTC()
+	return m, nil
+}
+
+// TxPublish - Insert event into outbox within caller transaction, delivered by Relay once committed
+func TxPublish(tx *sqlx.Tx, topic string, key string, payload interface{}) (*Model, error) {
+	m, err := Prepare(topic, key, payload)
+	if err != nil {
+		liblogger.Log(nil, true).Errorf("Error marshal outbox payload %v", err)
+		return nil, err
+	}
+
+	err = libdb.TxCreate(tx, TConfig, m, dbMode, false)
+	return m, err
+}
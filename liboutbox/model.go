@@ -0,0 +1,16 @@
+package liboutbox
+
+import "database/sql"
+
+// Model -
+type Model struct {
+	ID            string         `db:"id" json:"id"`
+	Topic         string         `db:"topic" json:"topic"`
+	EventKey      string         `db:"event_key" json:"event_key"`
+	Payload       string         `db:"payload" json:"payload"`
+	Attempt       int64          `db:"attempt" json:"attempt"`
+	LastError     sql.NullString `db:"last_error" json:"last_error"`
+	NextAttemptAt sql.NullTime   `db:"next_attempt_at" json:"next_attempt_at"`
+	DeliveredAt   sql.NullTime   `db:"delivered_at" json:"delivered_at"`
+	CreatedAt     sql.NullTime   `db:"created_at" json:"created_at"`
+}
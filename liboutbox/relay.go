@@ -0,0 +1,151 @@
+package liboutbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/helloferdie/golib/libdb"
+	"github.com/helloferdie/golib/liblogger"
+	"github.com/jmoiron/sqlx"
+)
+
+// Relay - Poll undelivered outbox events and publish them to sink
+//   - Interval: Poll interval, default to 1 second
+//   - BatchSize: Maximum events per poll, default to 100
+//   - MaxAttempt: Event is no longer retried after reaching max attempt, default to 10
+//   - Backoff: Base retry delay doubled on each attempt, default to 1 second, capped at 1 hour
+//   - Lease: Claimed events are hidden from other relays for lease duration while publishing, default to 1 minute,
+//     event is published again once lease expired without result, e.g. relay crashed
+type Relay struct {
+	DB         *sqlx.DB
+	Sink       Sink
+	Interval   time.Duration
+	BatchSize  int64
+	MaxAttempt int64
+	Backoff    time.Duration
+	Lease      time.Duration
+}
+
+// loadDefault -
+func (r *Relay) loadDefault() {
+	if r.Interval <= 0 {
+		r.Interval = time.Second
+	}
+	if r.BatchSize <= 0 {
+		r.BatchSize = 100
+	}
+	if r.MaxAttempt <= 0 {
+		r.MaxAttempt = 10
+	}
+	if r.Backoff <= 0 {
+		r.Backoff = time.Second
+	}
+	if r.Lease <= 0 {
+		r.Lease = time.Minute
+	}
+}
+
+// Run - Run relay until context cancelled
+func (r *Relay) Run(ctx context.Context) {
+	r.loadDefault()
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := r.Poll(ctx)
+		if err != nil {
+			liblogger.Log(nil, true).Errorf("Error relay outbox %v", err)
+		}
+
+		// Continue immediately when batch is full
+		if n < int(r.BatchSize) || err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		} else if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// Poll - Publish single batch of due events, return number of processed events.
+// Events are claimed in short transaction, published outside it, then marked individually
+func (r *Relay) Poll(ctx context.Context) (int, error) {
+	r.loadDefault()
+	list, err := r.claim()
+	if err != nil {
+		return 0, err
+	}
+
+	for k := range list {
+		m := &list[k]
+		if ctx.Err() != nil {
+			// Unpublished events become due again once lease expired
+			return k, ctx.Err()
+		}
+
+		now := time.Now().UTC()
+		values := map[string]interface{}{"id": m.ID, "now": now}
+		query := "UPDATE " + TConfig.Table + " SET delivered_at = :now, attempt = attempt + 1, last_error = NULL WHERE id = :id"
+		errPublish := r.Sink.Publish(ctx, m)
+		if errPublish != nil {
+			liblogger.Log(nil, true).Errorf("Error publish outbox event %s %v", m.ID, errPublish)
+			values["last_error"] = errPublish.Error()
+			values["next_attempt_at"] = now.Add(r.backoff(m.Attempt + 1))
+			query = "UPDATE " + TConfig.Table + " SET attempt = attempt + 1, last_error = :last_error, next_attempt_at = :next_attempt_at WHERE id = :id"
+		}
+
+		_, err = r.DB.NamedExecContext(context.Background(), query, values)
+		if err != nil {
+			return k, err
+		}
+	}
+	return len(list), nil
+}
+
+// claim - Lock due events, skipping rows locked by relay in other instances, and push their next attempt
+// by lease duration so they are not claimed again while being published
+func (r *Relay) claim() ([]Model, error) {
+	tx, err := libdb.TxBegin(r.DB)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	list := []Model{}
+	err = libdb.TxSelect(tx, &list, "SELECT "+TConfig.Fields+" FROM "+TConfig.Table+" WHERE delivered_at IS NULL AND attempt < :max_attempt "+
+		"AND (next_attempt_at IS NULL OR next_attempt_at <= :now) ORDER BY created_at LIMIT :limit FOR UPDATE SKIP LOCKED", map[string]interface{}{
+		"max_attempt": r.MaxAttempt,
+		"now":         now,
+		"limit":       r.BatchSize,
+	})
+	if err != nil || len(list) == 0 {
+		return list, err
+	}
+
+	ids := make([]string, 0, len(list))
+	for _, m := range list {
+		ids = append(ids, m.ID)
+	}
+	values := map[string]interface{}{"lease": now.Add(r.Lease)}
+	_, err = tx.NamedExec("UPDATE "+TConfig.Table+" SET next_attempt_at = :lease WHERE 1=1 "+libdb.PrepareInQuery("AND id IN", "id", ids, values), values)
+	if err != nil {
+		return nil, err
+	}
+	return list, tx.Commit()
+}
+
+// backoff - Exponential retry delay for given attempt
+func (r *Relay) backoff(attempt int64) time.Duration {
+	d := r.Backoff
+	for i := int64(1); i < attempt && d < time.Hour; i++ {
+		d *= 2
+	}
+	if d > time.Hour {
+		d = time.Hour
+	}
+	return d
+}
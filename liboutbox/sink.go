@@ -0,0 +1,69 @@
+package liboutbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/helloferdie/golib/libhttp"
+	"github.com/helloferdie/golib/libredis"
+)
+
+// Sink - Destination of outbox event
+type Sink interface {
+	Publish(ctx context.Context, m *Model) error
+}
+
+// SinkFunc - Adapter to use ordinary function as Sink
+type SinkFunc func(ctx context.Context, m *Model) error
+
+// Publish -
+func (f SinkFunc) Publish(ctx context.Context, m *Model) error {
+	return f(ctx, m)
+}
+
+// RedisSink - Publish event to redis stream, stream name is prefix followed by topic
+type RedisSink struct {
+	Client *libredis.Client
+	Prefix string
+	MaxLen int64
+}
+
+// Publish -
+func (s *RedisSink) Publish(ctx context.Context, m *Model) error {
+	_, err := s.Client.XAddContext(ctx, s.Prefix+m.Topic, map[string]interface{}{
+		"id":      m.ID,
+		"topic":   m.Topic,
+		"key":     m.EventKey,
+		"payload": m.Payload,
+	}, s.MaxLen)
+	return err
+}
+
+// HTTPSink - Publish event as JSON POST request, non 2xx response is treated as failure
+type HTTPSink struct {
+	Address string
+	Header  map[string]string
+}
+
+// Publish -
+func (s *HTTPSink) Publish(ctx context.Context, m *Model) error {
+	var payload interface{}
+	if err := json.Unmarshal([]byte(m.Payload), &payload); err != nil {
+		payload = m.Payload
+	}
+
+	_, code, err := libhttp.RequestRawContext(ctx, s.Address, "POST", map[string]interface{}{
+		"id":      m.ID,
+		"topic":   m.Topic,
+		"key":     m.EventKey,
+		"payload": payload,
+	}, s.Header)
+	if err != nil {
+		return err
+	}
+	if code < 200 || code > 299 {
+		return fmt.Errorf("Error publish outbox event: unexpected status code %d", code)
+	}
+	return nil
+}
@@ -6,17 +6,25 @@ import (
 	"errors"
 	"os"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/helloferdie/golib/liblogger"
+	"github.com/helloferdie/golib/libsecret"
 
 	"github.com/redis/go-redis/v9"
 )
 
+var configMu sync.Mutex
 var initialize = false
+var watchSecret = false
 var enable = false
 var opt = redis.Options{}
 
+// version - Incremented when password rotated, client built with older version is recreated
+var version int64
+
 // Client - Redis client instance
 type Client struct {
 	HasInitialize bool
@@ -24,53 +32,91 @@ type Client struct {
 	Duration      time.Duration
 	Enable        bool
 	ctx           context.Context
+
+	mu      sync.Mutex
+	version int64
 }
 
-// loadConfig -
-func loadConfig() {
+// loadConfig - Load configuration once, reloaded after password rotated
+func loadConfig() (redis.Options, bool) {
+	configMu.Lock()
+	defer configMu.Unlock()
 	if !initialize {
 		db, err := strconv.Atoi(os.Getenv("redis_db"))
 		if err != nil {
 			db = 0
 		}
 
-		if os.Getenv("redis") == "1" {
-			enable = true
+		enable = os.Getenv("redis") == "1"
+
+		if !watchSecret {
+			libsecret.OnChange("redis_password", func(string) {
+				configMu.Lock()
+				defer configMu.Unlock()
+				initialize = false
+				atomic.AddInt64(&version, 1)
+			})
+			watchSecret = true
 		}
 
 		opt = redis.Options{
 			Addr:     os.Getenv("redis_address"),
 			Username: os.Getenv("redis_username"),
-			Password: os.Getenv("redis_password"),
+			Password: libsecret.Get("redis_password"),
 			DB:       db,
 		}
 		initialize = true
 	}
+	return opt, enable
 }
 
 // Initialize - Initialize client
 func (cl *Client) Initialize() {
-	loadConfig()
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.initialize()
+}
+
+// initialize - Build redis client from current configuration, previous client closed after in-flight command finished
+func (cl *Client) initialize() {
+	v := atomic.LoadInt64(&version)
+	o, en := loadConfig()
 
-	cl.ctx = context.Background()
-	cl.Redis = redis.NewClient(&opt)
-	cl.Duration = time.Minute * time.Duration(5)
-	cl.Enable = enable
+	if old := cl.Redis; old != nil {
+		time.AfterFunc(time.Minute, func() {
+			old.Close()
+		})
+	}
+	if !cl.HasInitialize {
+		cl.ctx = context.Background()
+		cl.Duration = time.Minute * time.Duration(5)
+	}
+	cl.Redis = redis.NewClient(&o)
+	cl.Enable = en
 	cl.HasInitialize = true
+	cl.version = v
+}
+
+// client - Get redis client and enable flag, client recreated when password rotated
+func (cl *Client) client() (*redis.Client, bool) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if !cl.HasInitialize || cl.version != atomic.LoadInt64(&version) {
+		cl.initialize()
+	}
+	return cl.Redis, cl.Enable
 }
 
 // Set - Set key & value
 func (cl *Client) Set(key string, value interface{}, force bool) error {
-	if !cl.HasInitialize {
-		cl.Initialize()
-	}
+	rc, _ := cl.client()
 
 	err := errors.New("unknown")
 	if force {
-		err = cl.Redis.Set(cl.ctx, key, value, cl.Duration).Err()
+		err = rc.Set(cl.ctx, key, value, cl.Duration).Err()
 	} else {
 		// Set only if not exist
-		err = cl.Redis.SetNX(cl.ctx, key, value, cl.Duration).Err()
+		err = rc.SetNX(cl.ctx, key, value, cl.Duration).Err()
 	}
 
 	if err != nil {
@@ -83,15 +129,13 @@ func (cl *Client) Set(key string, value interface{}, force bool) error {
 
 // SetCustomDuration - Set key & value with custom duration
 func (cl *Client) SetCustomDuration(key string, value interface{}, force bool, duration time.Duration) error {
-	if !cl.HasInitialize {
-		cl.Initialize()
-	}
+	rc, _ := cl.client()
 
 	err := errors.New("unknown")
 	if force {
-		err = cl.Redis.Set(cl.ctx, key, value, duration).Err()
+		err = rc.Set(cl.ctx, key, value, duration).Err()
 	} else {
-		err = cl.Redis.SetNX(cl.ctx, key, value, duration).Err()
+		err = rc.SetNX(cl.ctx, key, value, duration).Err()
 	}
 
 	if err != nil {
@@ -104,15 +148,12 @@ func (cl *Client) SetCustomDuration(key string, value interface{}, force bool, d
 
 // Get - Get value based on provided key
 func (cl *Client) Get(key string) (interface{}, bool, error) {
-	if !cl.HasInitialize {
-		cl.Initialize()
-	}
-
-	if !enable {
+	rc, en := cl.client()
+	if !en {
 		return "", false, nil
 	}
 
-	val, err := cl.Redis.Get(cl.ctx, key).Result()
+	val, err := rc.Get(cl.ctx, key).Result()
 	if err == redis.Nil {
 		return val, false, nil
 	} else if err != nil {
@@ -125,15 +166,12 @@ func (cl *Client) Get(key string) (interface{}, bool, error) {
 
 // GetUnmarshal - Get unmarshal value based on provided key
 func (cl *Client) GetUnmarshal(key string, dt interface{}) (bool, error) {
-	if !cl.HasInitialize {
-		cl.Initialize()
-	}
-
-	if !enable {
+	rc, en := cl.client()
+	if !en {
 		return false, nil
 	}
 
-	rdVal, err := cl.Redis.Get(cl.ctx, key).Result()
+	rdVal, err := rc.Get(cl.ctx, key).Result()
 	if err == redis.Nil {
 		return false, nil
 	} else if err != nil {
@@ -153,15 +191,12 @@ func (cl *Client) GetUnmarshal(key string, dt interface{}) (bool, error) {
 
 // Delete - Delete value based on provided key
 func (cl *Client) Delete(key string) (int64, bool, error) {
-	if !cl.HasInitialize {
-		cl.Initialize()
-	}
-
-	if !enable {
+	rc, en := cl.client()
+	if !en {
 		return 0, false, nil
 	}
 
-	val, err := cl.Redis.Del(cl.ctx, key).Result()
+	val, err := rc.Del(cl.ctx, key).Result()
 	if err == redis.Nil {
 		return val, false, nil
 	} else if err != nil {
@@ -171,3 +206,69 @@ func (cl *Client) Delete(key string) (int64, bool, error) {
 	}
 	return val, true, nil
 }
+
+// XAdd - Append values to stream, trimmed approximately to maxLen when maxLen > 0
+func (cl *Client) XAdd(stream string, values map[string]interface{}, maxLen int64) (string, error) {
+	return cl.XAddContext(context.Background(), stream, values, maxLen)
+}
+
+// XAddContext - Append values to stream bound to context, trimmed approximately to maxLen when maxLen > 0
+func (cl *Client) XAddContext(ctx context.Context, stream string, values map[string]interface{}, maxLen int64) (string, error) {
+	rc, _ := cl.client()
+	id, err := rc.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: maxLen,
+		Approx: maxLen > 0,
+		Values: values,
+	}).Result()
+	if err != nil {
+		tmpErr := errors.New("Failed to add redis stream")
+		liblogger.Log(nil, true).Errorf("Error: %v %s %v", tmpErr, stream, err)
+		return "", tmpErr
+	}
+	return id, nil
+}
+
+// leaseScript - Renew key held by owner, otherwise set when not exist
+var leaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 1
+end
+return 0`)
+
+// unleaseScript - Delete key only when held by owner
+var unleaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+
+// Lease - Acquire or renew key for owner until duration expires, false when held by another owner
+func (cl *Client) Lease(key string, owner string, duration time.Duration) (bool, error) {
+	rc, _ := cl.client()
+
+	v, err := leaseScript.Run(cl.ctx, rc, []string{key}, owner, duration.Milliseconds()).Int()
+	if err != nil {
+		tmpErr := errors.New("Failed to lease redis key")
+		liblogger.Log(nil, true).Errorf("Error: %v %s %v", tmpErr, key, err)
+		return false, tmpErr
+	}
+	return v == 1, nil
+}
+
+// Unlease - Release key held by owner
+func (cl *Client) Unlease(key string, owner string) error {
+	rc, _ := cl.client()
+
+	err := unleaseScript.Run(cl.ctx, rc, []string{key}, owner).Err()
+	if err != nil {
+		tmpErr := errors.New("Failed to unlease redis key")
+		liblogger.Log(nil, true).Errorf("Error: %v %s %v", tmpErr, key, err)
+		return tmpErr
+	}
+	return nil
+}
@@ -194,3 +194,11 @@ func (r *Response) ErrorForbidden() *Response {
 	r.Error = "common.error.request.forbidden"
 	return r
 }
+
+// ErrorUnavailable -
+func (r *Response) ErrorUnavailable() *Response {
+	r.Code = 503
+	r.Message = "common.error.server.unavailable"
+	r.Error = "common.error.service.unavailable"
+	return r
+}
@@ -0,0 +1,185 @@
+package libsecret
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/helloferdie/golib/liblogger"
+)
+
+// ErrNotFound - Secret not found in any provider
+var ErrNotFound = errors.New("Error secret: not found")
+
+// Provider - Source of secret value, return false when secret is not available from the provider
+type Provider interface {
+	Get(name string) (string, bool, error)
+}
+
+var mu sync.RWMutex
+var providers = []Provider{EnvFileProvider{}}
+
+// SetProvider - Replace provider chain, first provider returning the secret wins
+func SetProvider(p ...Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers = p
+}
+
+// AddProvider - Add provider in front of current provider chain
+func AddProvider(p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers = append([]Provider{p}, providers...)
+}
+
+// Lookup - Resolve secret from provider chain
+func Lookup(name string) (string, error) {
+	mu.RLock()
+	list := providers
+	mu.RUnlock()
+
+	for _, p := range list {
+		v, ok, err := p.Get(name)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return v, nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+// Get - Resolve secret, return empty string when not found or failed to resolve
+func Get(name string) string {
+	v, err := Lookup(name)
+	if err != nil && err != ErrNotFound {
+		liblogger.Log(nil, true).Errorf("Error resolve secret %s %v", name, err)
+	}
+	return v
+}
+
+// EnvFileProvider - Read secret from file path in `<name>_FILE` (or `<name>_file`), fallback to `<name>` environment variable
+type EnvFileProvider struct{}
+
+// Get -
+func (EnvFileProvider) Get(name string) (string, bool, error) {
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		path = os.Getenv(name + "_file")
+	}
+	if path != "" {
+		bt, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, err
+		}
+		return strings.TrimRight(string(bt), "\r\n"), true, nil
+	}
+	v, ok := os.LookupEnv(name)
+	return v, ok, nil
+}
+
+// MapProvider - In memory provider, stand-in vault for tests
+type MapProvider struct {
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+// NewMapProvider -
+func NewMapProvider(values map[string]string) *MapProvider {
+	p := &MapProvider{values: map[string]string{}}
+	for k, v := range values {
+		p.values[k] = v
+	}
+	return p
+}
+
+// Set - Set or rotate secret value
+func (p *MapProvider) Set(name string, value string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.values[name] = value
+}
+
+// Get -
+func (p *MapProvider) Get(name string) (string, bool, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	v, ok := p.values[name]
+	return v, ok, nil
+}
+
+// watcher - Secret reload watcher
+type watcher struct {
+	value     string
+	callbacks []func(value string)
+}
+
+var watchMu sync.Mutex
+var watchers = map[string]*watcher{}
+var watchStarted = false
+
+// OnChange - Register callback invoked when secret value changed, checked every `secret_reload_seconds` (default 30)
+func OnChange(name string, fn func(value string)) {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+
+	w, ok := watchers[name]
+	if !ok {
+		v, _ := Lookup(name)
+		w = &watcher{value: v}
+		watchers[name] = w
+	}
+	w.callbacks = append(w.callbacks, fn)
+
+	if !watchStarted {
+		interval, err := strconv.Atoi(os.Getenv("secret_reload_seconds"))
+		if err != nil || interval <= 0 {
+			interval = 30
+		}
+		go watch(time.Duration(interval) * time.Second)
+		watchStarted = true
+	}
+}
+
+// Reload - Check every watched secret and invoke callbacks of changed ones
+func Reload() {
+	type change struct {
+		value     string
+		callbacks []func(value string)
+	}
+	changed := []change{}
+
+	watchMu.Lock()
+	for name, w := range watchers {
+		v, err := Lookup(name)
+		if err != nil && err != ErrNotFound {
+			liblogger.Log(nil, true).Errorf("Error reload secret %s %v", name, err)
+			continue
+		}
+		if v != w.value {
+			w.value = v
+			changed = append(changed, change{value: v, callbacks: append([]func(string){}, w.callbacks...)})
+		}
+	}
+	watchMu.Unlock()
+
+	for _, c := range changed {
+		for _, fn := range c.callbacks {
+			fn(c.value)
+		}
+	}
+}
+
+// watch -
+func watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		Reload()
+	}
+}
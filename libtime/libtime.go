@@ -34,6 +34,12 @@ func Now() time.Time {
 	return time.Now().In(cfg.Timezone)
 }
 
+// Location - Return environment app timezone
+func Location() *time.Location {
+	loadConfig()
+	return cfg.Timezone
+}
+
 // NowToString - Return Now() to format yyyy-mm-dd hh:ii:ss
 func NowToString() string {
 	return Now().Format("2006-01-02 15:04:05")